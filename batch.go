@@ -0,0 +1,151 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// mediaIDLine matches a bare idMedia in a batch file.
+var mediaIDLine = regexp.MustCompile(`^\d+$`)
+
+// queueItem is an episode to download along with the provider resolving it.
+type queueItem struct {
+	// Source is the input (URL or idMedia) the episode was listed from.
+	Source string
+	// Position is the 1-based position of the episode in the source's
+	// listing.
+	Position int
+	Provider Provider
+	Episode  Episode
+}
+
+// readBatchFile reads the sources listed in the file, one per line. Empty
+// lines and comments starting with # are ignored. "-" reads from stdin.
+func readBatchFile(path string) ([]string, error) {
+	var r io.Reader = os.Stdin
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	var sources []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if idx := strings.Index(line, " #"); idx >= 0 {
+			line = line[:idx]
+		}
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		sources = append(sources, line)
+	}
+	return sources, scanner.Err()
+}
+
+// buildQueue lists the episodes of every source using the matching provider
+// and keeps the ones selected by the filter. Bare numbers are treated as
+// media ids. Sources that can't be listed are recorded in the summary and
+// skipped.
+func buildQueue(ctx context.Context, sources []string, filter *episodeFilter, summary *runSummary) []queueItem {
+	var queue []queueItem
+	for _, src := range sources {
+		if ctx.Err() != nil {
+			break
+		}
+		var provider Provider
+		var episodes []Episode
+		var err error
+		if mediaIDLine.MatchString(src) {
+			mp := &mediaProvider{}
+			provider = mp
+			episodes, err = mp.listMedia(ctx, []string{src}, medianetAppCode)
+		} else {
+			var show *Show
+			if provider, show, err = listShow(ctx, src); err == nil {
+				episodes = show.Episodes()
+			}
+		}
+		if err != nil {
+			loggerFrom(ctx).Errorf("Failed to list %s - %v", src, err)
+			summary.listingFailed(src, err)
+			continue
+		}
+		queue = append(queue, queueEpisodes(ctx, src, provider, episodes, filter, summary)...)
+	}
+	return queue
+}
+
+// queueEpisodes queues the episodes of a source selected by the filter.
+// Episodes are named before filtering so their names don't depend on the
+// filters.
+func queueEpisodes(ctx context.Context, src string, provider Provider, episodes []Episode, filter *episodeFilter, summary *runSummary) []queueItem {
+	nameEpisodes(ctx, episodePointers(episodes))
+	selected := filter.apply(episodes)
+	summary.listed(src, len(selected))
+	queue := make([]queueItem, 0, len(selected))
+	for _, i := range selected {
+		queue = append(queue, queueItem{Source: src, Position: i + 1, Provider: provider, Episode: episodes[i]})
+	}
+	return queue
+}
+
+// disambiguateQueue renames the queued episodes of different sources still
+// ending up with the same file name.
+func disambiguateQueue(ctx context.Context, queue []queueItem) {
+	episodes := make([]*Episode, len(queue))
+	for i := range queue {
+		episodes[i] = &queue[i].Episode
+	}
+	disambiguateTitles(ctx, episodes)
+}
+
+func episodePointers(episodes []Episode) []*Episode {
+	ptrs := make([]*Episode, len(episodes))
+	for i := range episodes {
+		ptrs[i] = &episodes[i]
+	}
+	return ptrs
+}
+
+// tagsLine describes the rating and tags of the episode, if any.
+func tagsLine(ep Episode) string {
+	var parts []string
+	if ep.Rating != "" {
+		parts = append(parts, "rated "+ep.Rating)
+	}
+	for _, tag := range ep.Tags {
+		parts = append(parts, tag.Title)
+	}
+	if len(parts) == 0 {
+		return ""
+	}
+	return " | " + strings.Join(parts, ", ")
+}
+
+// printQueue lists the queued episodes by source and season, with their
+// position in the listing as used by -episodes.
+func printQueue(w io.Writer, queue []queueItem) {
+	source, season := "", 0
+	for _, item := range queue {
+		if item.Source != source {
+			source, season = item.Source, 0
+			fmt.Fprintln(w, source)
+		}
+		if n := item.Episode.SeasonNumber; n != season && n > 0 && !item.Episode.Extra {
+			season = n
+			fmt.Fprintf(w, " Season %d\n", n)
+		}
+		fmt.Fprintf(w, "  %3d. %s%s\n", item.Position, episodeLine(item.Episode), tagsLine(item.Episode))
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+)
+
+// nameEpisodes names the listed episodes so different episodes sharing a
+// title, for instance "Épisode 1" of several seasons, are saved under
+// different names. The files of the episodes with season and episode
+// numbers are prefixed with them, the other episodes get a suffix which only
+// depends on the episode, whether or not its title is shared, so its name
+// doesn't change when episodes are published or listed together: its air
+// date, otherwise its media id, otherwise the episode id of the provider. It
+// must be called once per listing.
+func nameEpisodes(ctx context.Context, episodes []*Episode) {
+	for _, ep := range episodes {
+		if suffix := episodeSuffix(ep); suffix != "" {
+			ep.Title = fmt.Sprintf("%s (%s)", ep.Title, suffix)
+		}
+	}
+	disambiguateTitles(ctx, episodes)
+}
+
+// episodeSuffix returns what tells the episode apart from the other
+// episodes sharing its title, empty when the listing provides nothing or
+// when its file is already named after its code.
+func episodeSuffix(ep *Episode) string {
+	if ep.code() != "" {
+		return ""
+	}
+	if !ep.AirDate.IsZero() {
+		return ep.AirDate.Format("2006-01-02")
+	}
+	if ep.IDMedia != "" {
+		return ep.IDMedia
+	}
+	return ep.ID
+}
+
+// disambiguateTitles renames the different episodes which still end up with
+// the same file name, those without anything identifying them, aired the
+// same day or numbered alike, by appending a short hash of their URL. Episodes listed twice
+// are left alone and calling it again doesn't rename anything.
+func disambiguateTitles(ctx context.Context, episodes []*Episode) {
+	groups := map[string][]*Episode{}
+	var keys []string
+	for _, ep := range episodes {
+		key := filenames.nameKey(fileTitle(ep))
+		if _, ok := groups[key]; !ok {
+			keys = append(keys, key)
+		}
+		groups[key] = append(groups[key], ep)
+	}
+
+	for _, key := range keys {
+		group := uniqueEpisodes(groups[key])
+		if len(group) < 2 {
+			continue
+		}
+		for _, ep := range group {
+			title := fmt.Sprintf("%s (%s)", ep.Title, urlSuffix(ep))
+			loggerFrom(ctx).Infof("Several episodes are titled %q, %s is saved as %q", ep.Title, ep.URL, title)
+			// copies of the same episode keep the same name
+			for _, other := range groups[key] {
+				if other != ep && sameEpisode(other, ep) {
+					other.Title = title
+				}
+			}
+			ep.Title = title
+		}
+	}
+}
+
+// uniqueEpisodes drops the episodes listed more than once.
+func uniqueEpisodes(episodes []*Episode) []*Episode {
+	var unique []*Episode
+	for _, ep := range episodes {
+		seen := false
+		for _, u := range unique {
+			if sameEpisode(u, ep) {
+				seen = true
+				break
+			}
+		}
+		if !seen {
+			unique = append(unique, ep)
+		}
+	}
+	return unique
+}
+
+func sameEpisode(a, b *Episode) bool {
+	if a.IDMedia != "" || b.IDMedia != "" {
+		return a.IDMedia == b.IDMedia
+	}
+	return a.URL == b.URL
+}
+
+// urlSuffix is a short hash of the episode's page, different episodes have
+// different pages.
+func urlSuffix(ep *Episode) string {
+	sum := sha1.Sum([]byte(ep.URL))
+	return hex.EncodeToString(sum[:4])
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+// titles returns the titles the files of the episodes are named after.
+func titles(episodes []Episode) []string {
+	var t []string
+	for i := range episodes {
+		t = append(t, fileTitle(&episodes[i]))
+	}
+	return t
+}
+
+func jeunesseEpisode(title, id string) Episode {
+	u := "https://ici.radio-canada.ca/jeunesse/scolaire/emissions/1080/mouss-boubidi/episodes/" + id + "/episode/emission"
+	return Episode{Title: title, URL: u, ID: jeunesseEpisodeID(u)}
+}
+
+func TestNameEpisodes(t *testing.T) {
+	tests := []struct {
+		name     string
+		episodes []Episode
+		want     []string
+	}{
+		{
+			name: "nothing identifying the episodes",
+			episodes: []Episode{
+				{Title: "Épisode 1", URL: "a"},
+				{Title: "Épisode 2", URL: "b"},
+			},
+			want: []string{"Épisode 1", "Épisode 2"},
+		},
+		{
+			name: "season and episode numbers",
+			episodes: []Episode{
+				{Title: "Épisode 1", URL: "a", SeasonNumber: 1, EpisodeNumber: 1, AirDate: date("2020-01-01")},
+				{Title: "Épisode 1", URL: "b", SeasonNumber: 2, EpisodeNumber: 1, AirDate: date("2021-01-01")},
+			},
+			want: []string{"S01E01 - Épisode 1", "S02E01 - Épisode 1"},
+		},
+		{
+			name: "air dates",
+			episodes: []Episode{
+				{Title: "Épisode 1", URL: "a", AirDate: date("2020-01-01"), IDMedia: "1"},
+				{Title: "Épisode 1", URL: "b", AirDate: date("2021-01-01"), IDMedia: "2"},
+			},
+			want: []string{"Épisode 1 (2020-01-01)", "Épisode 1 (2021-01-01)"},
+		},
+		{
+			name: "mixed",
+			episodes: []Episode{
+				{Title: "Épisode 1", URL: "a", SeasonNumber: 1, EpisodeNumber: 1},
+				{Title: "Épisode 1", URL: "b", SeasonNumber: 2, EpisodeNumber: 1},
+				{Title: "Épisode 1", URL: "c", AirDate: date("2020-01-01")},
+				{Title: "Épisode 1", URL: "d", IDMedia: "4"},
+			},
+			want: []string{"S01E01 - Épisode 1", "S02E01 - Épisode 1", "Épisode 1 (2020-01-01)", "Épisode 1 (4)"},
+		},
+		{
+			name: "same air date",
+			episodes: []Episode{
+				{Title: "Épisode 1", URL: "a", AirDate: date("2020-01-01")},
+				{Title: "Épisode 1", URL: "b", AirDate: date("2020-01-01")},
+			},
+			want: []string{"Épisode 1 (2020-01-01) (" + urlSuffix(&Episode{URL: "a"}) + ")", "Épisode 1 (2020-01-01) (" + urlSuffix(&Episode{URL: "b"}) + ")"},
+		},
+		{
+			name: "jeunesse episode ids",
+			episodes: []Episode{
+				jeunesseEpisode("Épisode 1", "367664"),
+				jeunesseEpisode("Épisode 1", "367701"),
+			},
+			want: []string{"Épisode 1 (367664)", "Épisode 1 (367701)"},
+		},
+		{
+			name: "URL hash",
+			episodes: []Episode{
+				{Title: "Épisode 1", URL: "https://example.com/a"},
+				{Title: "Épisode 1", URL: "https://example.com/b"},
+			},
+			want: []string{"Épisode 1 (" + urlSuffix(&Episode{URL: "https://example.com/a"}) + ")", "Épisode 1 (" + urlSuffix(&Episode{URL: "https://example.com/b"}) + ")"},
+		},
+		{
+			name: "same file name",
+			episodes: []Episode{
+				{Title: "Qui?", URL: "a"},
+				{Title: "Qui?", URL: "b"},
+				{Title: "QUI?", URL: "c", IDMedia: "3"},
+			},
+			want: []string{"Qui? (" + urlSuffix(&Episode{URL: "a"}) + ")", "Qui? (" + urlSuffix(&Episode{URL: "b"}) + ")", "QUI? (3)"},
+		},
+		{
+			name: "case insensitive",
+			episodes: []Episode{
+				{Title: "Bonjour", URL: "a"},
+				{Title: "BONJOUR", URL: "b"},
+			},
+			want: []string{"Bonjour (" + urlSuffix(&Episode{URL: "a"}) + ")", "BONJOUR (" + urlSuffix(&Episode{URL: "b"}) + ")"},
+		},
+		{
+			name: "listed twice",
+			episodes: []Episode{
+				{Title: "Épisode 1", URL: "a"},
+				{Title: "Épisode 1", URL: "a"},
+			},
+			want: []string{"Épisode 1", "Épisode 1"},
+		},
+		{
+			name: "copies keep the same name",
+			episodes: []Episode{
+				{Title: "Épisode 1", URL: "a", IDMedia: "1", AirDate: date("2020-01-01")},
+				{Title: "Épisode 1", URL: "b", IDMedia: "2", AirDate: date("2020-01-01")},
+				{Title: "Épisode 1", URL: "c", IDMedia: "1", AirDate: date("2020-01-01")},
+			},
+			want: []string{"Épisode 1 (2020-01-01) (" + urlSuffix(&Episode{URL: "a"}) + ")", "Épisode 1 (2020-01-01) (" + urlSuffix(&Episode{URL: "b"}) + ")", "Épisode 1 (2020-01-01) (" + urlSuffix(&Episode{URL: "a"}) + ")"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nameEpisodes(context.Background(), episodePointers(tt.episodes))
+			if got := titles(tt.episodes); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("expected %q, got %q", tt.want, got)
+			}
+			// naming the queue again doesn't rename anything
+			disambiguateTitles(context.Background(), episodePointers(tt.episodes))
+			if got := titles(tt.episodes); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("renamed again to %q", got)
+			}
+		})
+	}
+}
+
+// TestDisambiguateTitlesStable checks that publishing a new episode, or
+// listing it with other shows, doesn't rename the episodes already
+// downloaded.
+func TestDisambiguateTitlesStable(t *testing.T) {
+	tests := []struct {
+		name          string
+		before, after []Episode
+	}{
+		{
+			name:   "jeunesse",
+			before: []Episode{jeunesseEpisode("Épisode 1", "100"), jeunesseEpisode("Épisode 1", "200")},
+			after:  []Episode{jeunesseEpisode("Épisode 1", "300"), jeunesseEpisode("Épisode 1", "100"), jeunesseEpisode("Épisode 1", "200")},
+		},
+		{
+			name:   "single episode becoming a group",
+			before: []Episode{jeunesseEpisode("Épisode 1", "100")},
+			after:  []Episode{jeunesseEpisode("Épisode 1", "200"), jeunesseEpisode("Épisode 1", "100")},
+		},
+		{
+			name:   "mixed group",
+			before: []Episode{{Title: "Épisode 1", URL: "a", SeasonNumber: 1, EpisodeNumber: 1}, {Title: "Épisode 1", URL: "b", SeasonNumber: 2, EpisodeNumber: 1}},
+			after:  []Episode{{Title: "Épisode 1", URL: "c", IDMedia: "3"}, {Title: "Épisode 1", URL: "a", SeasonNumber: 1, EpisodeNumber: 1}, {Title: "Épisode 1", URL: "b", SeasonNumber: 2, EpisodeNumber: 1}},
+		},
+		{
+			name:   "without ids",
+			before: []Episode{{Title: "Épisode 1", URL: "a"}, {Title: "Épisode 1", URL: "b"}},
+			after:  []Episode{{Title: "Épisode 1", URL: "c"}, {Title: "Épisode 1", URL: "a"}, {Title: "Épisode 1", URL: "b"}},
+		},
+		{
+			name:   "air dates",
+			before: []Episode{{Title: "Épisode 1", URL: "a", AirDate: date("2020-01-01")}, {Title: "Épisode 1", URL: "b", AirDate: date("2020-02-01")}},
+			after:  []Episode{{Title: "Épisode 1", URL: "c", AirDate: date("2020-03-01")}, {Title: "Épisode 1", URL: "a", AirDate: date("2020-01-01")}, {Title: "Épisode 1", URL: "b", AirDate: date("2020-02-01")}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nameEpisodes(context.Background(), episodePointers(tt.before))
+			nameEpisodes(context.Background(), episodePointers(tt.after))
+			names := map[string]string{}
+			for i, ep := range tt.before {
+				names[ep.URL] = fileTitle(&tt.before[i])
+			}
+			for i, ep := range tt.after {
+				if name, ok := names[ep.URL]; ok && name != fileTitle(&tt.after[i]) {
+					t.Errorf("%s renamed from %q to %q", ep.URL, name, fileTitle(&tt.after[i]))
+				}
+			}
+			got := titles(tt.after)
+			for _, other := range got[1:] {
+				if got[0] == other {
+					t.Errorf("expected the new episode to get its own name, got %q", got)
+				}
+			}
+		})
+	}
+}
+
+func TestDisambiguateQueueStable(t *testing.T) {
+	show := []Episode{jeunesseEpisode("Épisode 1", "100"), {Title: "Épisode 1", URL: "a", SeasonNumber: 1, EpisodeNumber: 1}}
+	other := []Episode{{Title: "Épisode 1", URL: "b", AirDate: date("2020-01-01")}}
+	ctx := context.Background()
+	queue := append(queueEpisodes(ctx, "show", nil, show, nil, newRunSummary()), queueEpisodes(ctx, "other", nil, other, nil, newRunSummary())...)
+	alone := titles(show)
+	disambiguateQueue(ctx, queue)
+	for i, item := range queue[:len(show)] {
+		if name := fileTitle(&item.Episode); name != alone[i] {
+			t.Errorf("expected %q whatever else is queued, got %q", alone[i], name)
+		}
+	}
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+
+	"github.com/mattetti/cbc/remux"
+)
+
+// converters are the available backends turning a downloaded transport
+// stream into a mp4 file.
+var converters = map[string]func(ctx context.Context, inTsPath, outMp4Path string) error{
+	"native": nativeTsToMp4,
+	"ffmpeg": ffmpegTsToMp4,
+}
+
+// partSuffix is appended to the name of the files being written, they are
+// renamed once complete so a file with the final name is always complete.
+const partSuffix = ".part"
+
+// convertTsToMp4 converts the ts file using the named converter and removes
+// it once the mp4 file was created. "auto" uses ffmpeg when it is installed
+// and the built-in remuxer otherwise. The mp4 is written to a .part file
+// which is renamed once the conversion succeeded and the file was verified.
+// If the conversion fails or is canceled, the partial file is removed and the
+// ts file is kept.
+func convertTsToMp4(ctx context.Context, converter, inTsPath, outMp4Path string) error {
+	if converter == "auto" {
+		converter = "native"
+		if _, err := exec.LookPath("ffmpeg"); err == nil {
+			converter = "ffmpeg"
+		}
+	}
+	convert, ok := converters[converter]
+	if !ok {
+		return fmt.Errorf("unknown converter %q", converter)
+	}
+	l := loggerFrom(ctx)
+	l.Debugf("Converting %s to %s using %s", inTsPath, outMp4Path, converter)
+	partPath := outMp4Path + partSuffix
+	if err := convert(ctx, inTsPath, partPath); err != nil {
+		os.Remove(partPath)
+		return err
+	}
+	if err := verifyMp4(partPath); err != nil {
+		os.Remove(partPath)
+		return fmt.Errorf("invalid mp4 file - %v", err)
+	}
+	if err := os.Rename(partPath, outMp4Path); err != nil {
+		os.Remove(partPath)
+		return err
+	}
+	if err := os.Remove(inTsPath); err != nil {
+		l.Warnf("Couldn't delete temp file: %s - %v", inTsPath, err)
+	}
+	return nil
+}
+
+// nativeTsToMp4 converts the ts file using the built-in remuxer.
+func nativeTsToMp4(ctx context.Context, inTsPath, outMp4Path string) error {
+	in, err := os.Open(inTsPath)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(outMp4Path)
+	if err != nil {
+		return err
+	}
+	if err = remux.Remux(&ctxReader{ctx: ctx, r: in}, out); err == nil {
+		err = out.Sync()
+	}
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// ffmpegTsToMp4 converts the ts file using ffmpeg, the audio stream is
+// converted from ADTS to the MPEG-4 AudioSpecificConfig format.
+func ffmpegTsToMp4(ctx context.Context, inTsPath, outMp4Path string) error {
+	ffmpegPath, err := exec.LookPath("ffmpeg")
+	if err != nil {
+		return fmt.Errorf("ffmpeg wasn't found on your system - %v", err)
+	}
+	// -y overwrites without asking, the format is explicit since the output
+	// name doesn't end with .mp4 while it is written
+	cmd := exec.CommandContext(ctx, ffmpegPath, "-y", "-i", inTsPath, "-vcodec", "copy", "-acodec", "copy", "-bsf:a", "aac_adtstoasc", "-f", "mp4", outMp4Path)
+	if loggerFrom(ctx).Enabled(levelDebug) {
+		cmd.Stdout = os.Stderr
+		cmd.Stderr = os.Stderr
+	}
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return fmt.Errorf("ffmpeg failed - %v (args: %v)", err, cmd.Args)
+	}
+	return nil
+}
+
+// verifyMp4 checks that the top level boxes of the mp4 file cover the whole
+// file and that the ftyp, moov and mdat boxes are present, which catches
+// truncated files.
+func verifyMp4(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	found := map[string]bool{}
+	header := make([]byte, 16)
+	var offset int64
+	for offset < fi.Size() {
+		if _, err := f.ReadAt(header[:8], offset); err != nil {
+			return fmt.Errorf("truncated box header at %d", offset)
+		}
+		size := int64(binary.BigEndian.Uint32(header))
+		typ := string(header[4:8])
+		switch size {
+		case 0:
+			// the box extends to the end of the file
+			size = fi.Size() - offset
+		case 1:
+			if _, err := f.ReadAt(header[8:16], offset+8); err != nil {
+				return fmt.Errorf("truncated %s box header at %d", typ, offset)
+			}
+			size = int64(binary.BigEndian.Uint64(header[8:16]))
+		}
+		if size < 8 || offset+size > fi.Size() {
+			return fmt.Errorf("truncated %s box at %d", typ, offset)
+		}
+		found[typ] = true
+		offset += size
+	}
+	for _, typ := range []string{"ftyp", "moov", "mdat"} {
+		if !found[typ] {
+			return fmt.Errorf("missing %s box", typ)
+		}
+	}
+	return nil
+}
+
+// ctxReader stops reading once the context is canceled.
+type ctxReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (c *ctxReader) Read(p []byte) (int, error) {
+	if err := c.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return c.r.Read(p)
+}
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// showFinder is implemented by the providers whose shows can be discovered
+// by crawling the index of a section.
+type showFinder interface {
+	// showPage returns the page listing the episodes of the show the link
+	// of the section index points to, false when the link isn't a show.
+	showPage(section, link *url.URL) (string, bool)
+}
+
+// catalogue is the JSON file describing what a crawl found.
+type catalogue struct {
+	Section   string          `json:"section"`
+	CrawledAt time.Time       `json:"crawledAt"`
+	Shows     []catalogueShow `json:"shows"`
+}
+
+type catalogueShow struct {
+	URL          string             `json:"url"`
+	Title        string             `json:"title,omitempty"`
+	ListingError string             `json:"listingError,omitempty"`
+	Episodes     []catalogueEpisode `json:"episodes"`
+}
+
+type catalogueEpisode struct {
+	Title         string  `json:"title"`
+	URL           string  `json:"url,omitempty"`
+	IDMedia       string  `json:"idMedia,omitempty"`
+	SeasonNumber  int     `json:"season,omitempty"`
+	EpisodeNumber int     `json:"episode,omitempty"`
+	AirDate       string  `json:"airDate,omitempty"`
+	Duration      float64 `json:"durationSeconds,omitempty"`
+	Rating        string  `json:"rating,omitempty"`
+	Tags          []Tag   `json:"tags,omitempty"`
+	Extra         bool    `json:"extra,omitempty"`
+	Paid          bool    `json:"paid,omitempty"`
+	Unavailable   bool    `json:"unavailable,omitempty"`
+}
+
+// crawlQueue parses the arguments of the crawl command, discovers the shows
+// of the section index, lists their episodes and writes the catalogue. The
+// selected episodes are queued, the returned boolean tells whether -download
+// was passed to download them.
+func crawlQueue(ctx context.Context, args []string, filter *episodeFilter, summary *runSummary) ([]queueItem, bool, error) {
+	fs := flag.NewFlagSet("crawl", flag.ExitOnError)
+	delay := fs.Duration("delay", 2*time.Second, "minimum pause between two requests to the website, including the downloads")
+	cataloguePath := fs.String("catalogue", "catalogue.json", "file the catalogue of the section is written to")
+	download := fs.Bool("download", false, "download the selected episodes of every show found")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		return nil, false, fmt.Errorf("you need to pass the URL of a section index")
+	}
+
+	pacerFrom(ctx).setDelay(*delay)
+	l := loggerFrom(ctx)
+	shows, err := findShows(ctx, fs.Arg(0))
+	if err != nil {
+		return nil, false, err
+	}
+	l.Infof("%d shows found in %s", len(shows), fs.Arg(0))
+
+	cat := &catalogue{Section: fs.Arg(0), CrawledAt: time.Now(), Shows: []catalogueShow{}}
+	var queue []queueItem
+	for i, showURL := range shows {
+		if ctx.Err() != nil {
+			break
+		}
+		l.Infof("[%d/%d] Listing %s", i+1, len(shows), showURL)
+		entry := catalogueShow{URL: showURL, Episodes: []catalogueEpisode{}}
+		provider, show, err := listShow(ctx, showURL)
+		if err != nil {
+			if ctx.Err() != nil {
+				break
+			}
+			l.Warnf("Failed to list %s - %v", showURL, err)
+			entry.ListingError = err.Error()
+			summary.listingFailed(showURL, err)
+			cat.Shows = append(cat.Shows, entry)
+			continue
+		}
+		entry.Title = show.Title
+		episodes := show.Episodes()
+		for _, ep := range episodes {
+			entry.Episodes = append(entry.Episodes, catalogueEntry(ep))
+		}
+		cat.Shows = append(cat.Shows, entry)
+		queue = append(queue, queueEpisodes(ctx, showURL, provider, episodes, filter, summary)...)
+	}
+
+	if err := cat.write(*cataloguePath); err != nil {
+		return nil, false, fmt.Errorf("failed to write the catalogue - %v", err)
+	}
+	l.Infof("Catalogue of %d shows written to %s", len(cat.Shows), *cataloguePath)
+	return queue, *download, nil
+}
+
+// findShows returns the pages listing the episodes of the shows linked from
+// the section index, in order of appearance.
+func findShows(ctx context.Context, sectionURL string) ([]string, error) {
+	provider, section, err := providerFor(sectionURL)
+	if err != nil {
+		return nil, err
+	}
+	finder, ok := provider.(showFinder)
+	if !ok {
+		return nil, fmt.Errorf("the %s provider doesn't support crawling", provider.Name())
+	}
+	res, err := httpGet(ctx, http.DefaultClient, section.String())
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != 200 {
+		return nil, fmt.Errorf("status code error: %d %s", res.StatusCode, res.Status)
+	}
+	doc, err := goquery.NewDocumentFromReader(res.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	var shows []string
+	seen := map[string]bool{}
+	doc.Find("a[href]").Each(func(i int, s *goquery.Selection) {
+		href, _ := s.Attr("href")
+		link, err := res.Request.URL.Parse(href)
+		if err != nil {
+			return
+		}
+		if page, ok := finder.showPage(section, link); ok && !seen[page] {
+			seen[page] = true
+			shows = append(shows, page)
+		}
+	})
+	if len(shows) == 0 {
+		return nil, fmt.Errorf("no show found in %s", sectionURL)
+	}
+	return shows, nil
+}
+
+func catalogueEntry(ep Episode) catalogueEpisode {
+	e := catalogueEpisode{
+		Title:         ep.Title,
+		URL:           ep.URL,
+		IDMedia:       ep.IDMedia,
+		SeasonNumber:  ep.SeasonNumber,
+		EpisodeNumber: ep.EpisodeNumber,
+		Duration:      ep.Duration.Seconds(),
+		Rating:        ep.Rating,
+		Tags:          ep.Tags,
+		Extra:         ep.Extra,
+		Paid:          ep.Paid,
+		Unavailable:   ep.Unavailable,
+	}
+	if !ep.AirDate.IsZero() {
+		e.AirDate = ep.AirDate.Format("2006-01-02")
+	}
+	return e
+}
+
+func (c *catalogue) write(path string) error {
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, append(data, '\n'), 0644)
+}
+
+// sleepContext pauses for d, returning early with the context error when it
+// is canceled.
+func sleepContext(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// requestPacer spaces out the requests to the website so a crawl doesn't
+// hammer it, a nil pacer doesn't wait.
+type requestPacer struct {
+	mu    sync.Mutex
+	delay time.Duration
+	last  time.Time
+}
+
+type pacerKey struct{}
+
+// withPacer returns a context whose requests are paced by p, nil stops
+// pacing them.
+func withPacer(ctx context.Context, p *requestPacer) context.Context {
+	return context.WithValue(ctx, pacerKey{}, p)
+}
+
+// pacerFrom returns the pacer carried by the context, nil if none.
+func pacerFrom(ctx context.Context) *requestPacer {
+	p, _ := ctx.Value(pacerKey{}).(*requestPacer)
+	return p
+}
+
+func (p *requestPacer) setDelay(d time.Duration) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	p.delay = d
+	p.mu.Unlock()
+}
+
+// wait blocks until the delay since the previous request has elapsed. The
+// requests of concurrent callers are spaced out too.
+func (p *requestPacer) wait(ctx context.Context) error {
+	if p == nil {
+		return nil
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if d := time.Until(p.last.Add(p.delay)); d > 0 {
+		if err := sleepContext(ctx, d); err != nil {
+			return err
+		}
+	}
+	p.last = time.Now()
+	return nil
+}
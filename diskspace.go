@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+var (
+	// MinFreeSpace is the space kept free on the temp and destination
+	// filesystems, on top of what the episode needs.
+	MinFreeSpace uint64 = 200 << 20
+	// LowSpacePolicy is what happens when a filesystem runs low on space:
+	// "abort" stops the run, "pause" waits until space is freed.
+	LowSpacePolicy = "abort"
+	// LowSpaceCheckInterval is how often the free space is checked while
+	// paused.
+	LowSpaceCheckInterval = 30 * time.Second
+
+	// errFreeSpaceUnsupported is returned by freeSpace on the platforms
+	// where the free space can't be read, the checks are then skipped.
+	errFreeSpaceUnsupported = errors.New("free space check not supported")
+)
+
+// lowSpaceError is returned when a filesystem doesn't have enough free space
+// and the policy is to abort.
+type lowSpaceError struct {
+	path   string
+	free   uint64
+	needed uint64
+}
+
+func (e *lowSpaceError) Error() string {
+	return fmt.Sprintf("not enough disk space on %s, %s free but %s needed",
+		e.path, formatBytes(int64(e.free)), formatBytes(int64(e.needed)))
+}
+
+func isLowSpace(err error) bool {
+	_, ok := err.(*lowSpaceError)
+	return ok
+}
+
+// waitForSpace checks that the filesystem of path has needed bytes free on
+// top of MinFreeSpace. When it doesn't, it either returns a *lowSpaceError or
+// waits for space to be freed, depending on LowSpacePolicy. The check is
+// skipped when the free space can't be read.
+func waitForSpace(ctx context.Context, path string, needed uint64) error {
+	l := loggerFrom(ctx)
+	paused := false
+	for {
+		free, err := freeSpace(existingDir(path))
+		if err != nil {
+			if err != errFreeSpaceUnsupported {
+				l.Debugf("Failed to read the free space of %s - %v", path, err)
+			}
+			return nil
+		}
+		if free >= needed+MinFreeSpace {
+			if paused {
+				l.Infof("Enough space on %s, resuming", path)
+			}
+			return nil
+		}
+		lowErr := &lowSpaceError{path: path, free: free, needed: needed + MinFreeSpace}
+		if LowSpacePolicy != "pause" {
+			return lowErr
+		}
+		if !paused {
+			l.Warnf("%v, paused until space is freed", lowErr)
+			paused = true
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(LowSpaceCheckInterval):
+		}
+	}
+}
+
+// existingDir returns path or its closest existing parent, so the
+// filesystem can be checked before the folders are created.
+func existingDir(path string) string {
+	path, _ = filepath.Abs(path)
+	for {
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+		parent := filepath.Dir(path)
+		if parent == path {
+			return path
+		}
+		path = parent
+	}
+}
@@ -0,0 +1,8 @@
+//go:build !linux && !darwin && !freebsd && !openbsd && !windows
+// +build !linux,!darwin,!freebsd,!openbsd,!windows
+
+package main
+
+func freeSpace(path string) (uint64, error) {
+	return 0, errFreeSpaceUnsupported
+}
@@ -0,0 +1,421 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+)
+
+var (
+	// TotalWorkers is the number of segments downloaded concurrently.
+	TotalWorkers = 4
+	// MaxRetries is the number of attempts made to download a segment.
+	MaxRetries = 3
+	// MaxRefreshes is the number of times the media URL of an episode is
+	// resolved again when its signed URL expires during the download.
+	MaxRefreshes = 3
+	// TmpDir is where the segments are downloaded before being assembled.
+	// It is stable across runs so interrupted downloads can be resumed.
+	TmpDir = filepath.Join(os.TempDir(), "cbc")
+)
+
+// dlJob is an episode to download.
+type dlJob struct {
+	URL      string
+	DestPath string
+	// Filename is the sanitized name of the episode, without extension.
+	Filename string
+	// Segments is the number of segments of the episode. When set before
+	// the download, segments left by a previous run are only reused if the
+	// playlist still has the same number of segments.
+	Segments int
+	// Downloaded is the number of segments available locally.
+	Downloaded int32
+	// Resolve, when set, returns a fresh media URL for the episode. It is
+	// called when the signed URL expires during the download.
+	Resolve func(ctx context.Context) (string, error)
+}
+
+// expiredURLError is returned when the server rejects a segment request,
+// which happens once the tokens of the signed media URL expired.
+type expiredURLError struct {
+	segment int
+	status  int
+}
+
+func (e *expiredURLError) Error() string {
+	return fmt.Sprintf("the media URL expired at segment %d (status code %d)", e.segment, e.status)
+}
+
+func isExpiredURL(err error) bool {
+	_, ok := err.(*expiredURLError)
+	return ok
+}
+
+// downloader downloads HLS streams one episode at a time, fetching the
+// segments of each episode concurrently.
+type downloader struct {
+	client   *http.Client
+	progress *progress
+	tmpDir   string
+}
+
+func newDownloader(p *progress) *downloader {
+	return &downloader{
+		client:   &http.Client{},
+		progress: p,
+		tmpDir:   TmpDir,
+	}
+}
+
+// download fetches all the segments of the job and assembles them into a ts
+// file, the path of which is returned. When the context is canceled, the
+// segments already downloaded are kept so the job can be resumed.
+func (d *downloader) download(ctx context.Context, job *dlJob) (string, error) {
+	pl, err := fetchPlaylist(ctx, d.client, job.URL)
+	if err != nil {
+		return "", err
+	}
+	if len(pl.Segments) == 0 {
+		return "", fmt.Errorf("no segments found in %s", pl.URL)
+	}
+	l := loggerFrom(ctx)
+	if pl.Rendition != nil {
+		l.Debugf("Chosen rendition: %s %d bps", pl.Rendition.Resolution, pl.Rendition.Bandwidth)
+	}
+	// the segments are assembled into a ts file in the destination which is
+	// then converted to mp4, so the destination needs twice the size
+	size := uint64(pl.estimatedSize())
+	if err := waitForSpace(ctx, d.tmpDir, size); err != nil {
+		return "", err
+	}
+	if err := waitForSpace(ctx, job.DestPath, 2*size); err != nil {
+		return "", err
+	}
+
+	job.DestPath = filenames.cleanPath(job.DestPath)
+	if job.Segments > 0 && job.Segments != len(pl.Segments) {
+		// the segments left by a previous run belong to another rendition
+		if err := os.RemoveAll(d.segmentDir(job)); err != nil {
+			return "", err
+		}
+	}
+	job.Segments = len(pl.Segments)
+	job.Downloaded = 0
+	if err := os.MkdirAll(d.segmentDir(job), os.ModePerm); err != nil {
+		return "", err
+	}
+	d.progress.StartEpisode(job.Filename, len(pl.Segments))
+
+	err = d.fetchSegments(ctx, job, pl, false)
+	for refreshes := 0; isExpiredURL(err) && job.Resolve != nil && refreshes < MaxRefreshes; refreshes++ {
+		l.Infof("%v, resolving it again", err)
+		if pl, err = d.refreshPlaylist(ctx, job, len(pl.Segments)); err != nil {
+			return "", err
+		}
+		err = d.fetchSegments(ctx, job, pl, true)
+	}
+	if err != nil {
+		return "", err
+	}
+	return d.assemble(ctx, job, pl)
+}
+
+// fetchSegments downloads the segments of the playlist which aren't in the
+// temp folder yet. Once a segment request is rejected because the URL
+// expired, no other segment is started and the expiredURLError is returned.
+// The segments already on disk are only counted on the first pass, retry
+// passes skip them.
+func (d *downloader) fetchSegments(ctx context.Context, job *dlJob, pl *playlist, retry bool) error {
+	// the segments are served by the CDN, pacing them would only slow the
+	// download down
+	passCtx, cancel := context.WithCancel(withPacer(ctx, nil))
+	defer cancel()
+	segs := make(chan int)
+	errs := make(chan error, len(pl.Segments))
+	wg := &sync.WaitGroup{}
+	for i := 0; i < TotalWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for pos := range segs {
+				err := d.downloadSegment(passCtx, job, pl.Segments[pos], pos)
+				switch {
+				case err == nil:
+					atomic.AddInt32(&job.Downloaded, 1)
+				case isExpiredURL(err):
+					cancel()
+				}
+				errs <- err
+			}
+		}()
+	}
+	var lowSpace error
+feed:
+	for i := range pl.Segments {
+		if retry && fileExists(d.segmentTmpPath(job, i)) {
+			continue
+		}
+		if lowSpace = waitForSpace(ctx, d.tmpDir, 0); lowSpace != nil {
+			break
+		}
+		select {
+		case segs <- i:
+		case <-passCtx.Done():
+			break feed
+		}
+	}
+	close(segs)
+	wg.Wait()
+	close(errs)
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if lowSpace != nil {
+		return lowSpace
+	}
+	// the other segments fail once the URL expired, the expiration is what
+	// needs to be handled
+	var firstErr error
+	for err := range errs {
+		if isExpiredURL(err) {
+			return err
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// refreshPlaylist resolves the media URL of the job again and fetches its
+// playlist, which needs to have the same segments for the ones already
+// downloaded to be kept.
+func (d *downloader) refreshPlaylist(ctx context.Context, job *dlJob, segments int) (*playlist, error) {
+	u, err := job.Resolve(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve the media URL again - %v", err)
+	}
+	pl, err := fetchPlaylist(ctx, d.client, u)
+	if err != nil {
+		return nil, err
+	}
+	if len(pl.Segments) != segments {
+		return nil, fmt.Errorf("the refreshed playlist has %d segments instead of %d", len(pl.Segments), segments)
+	}
+	loggerFrom(ctx).Debugf("Resolved the media again to %s", u)
+	job.URL = u
+	return pl, nil
+}
+
+// downloadSegment downloads a segment to the temp folder, retrying on
+// failure.
+func (d *downloader) downloadSegment(ctx context.Context, job *dlJob, seg segment, pos int) error {
+	l := loggerFrom(ctx).With("segment", pos)
+	destination := d.segmentTmpPath(job, pos)
+	if fileExists(destination) {
+		l.Tracef("Segment already downloaded")
+		d.progress.SegmentDone()
+		return nil
+	}
+
+	var err error
+	for attempt := 0; attempt < MaxRetries; attempt++ {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		err = d.fetchTo(ctx, seg.URL, destination)
+		if err == nil {
+			l.Tracef("Segment downloaded")
+			d.progress.SegmentDone()
+			return nil
+		}
+		if e, ok := err.(*expiredURLError); ok {
+			// retrying with the same URL won't help
+			e.segment = pos
+			return e
+		}
+		l.Debugf("Segment attempt %d failed - %v", attempt+1, err)
+	}
+	return fmt.Errorf("failed to download segment %d - %v", pos, err)
+}
+
+// fetchTo downloads u to destination. The content is written to a temporary
+// file first so a partial download is never mistaken for a complete one.
+func (d *downloader) fetchTo(ctx context.Context, u, destination string) error {
+	resp, err := httpGet(ctx, d.client, u)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusUnauthorized, http.StatusForbidden, http.StatusGone:
+		return &expiredURLError{status: resp.StatusCode}
+	default:
+		return fmt.Errorf("status code error: %d %s", resp.StatusCode, resp.Status)
+	}
+
+	tmp := destination + ".tmp"
+	out, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(out, &countingReader{r: resp.Body, progress: d.progress})
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, destination)
+}
+
+// assemble concatenates the downloaded segments, in order, into a ts file in
+// the destination folder. Encrypted segments are decrypted on the way. The ts
+// file is written to a .part file renamed once complete, the segments are
+// only removed then.
+func (d *downloader) assemble(ctx context.Context, job *dlJob, pl *playlist) (string, error) {
+	if err := os.MkdirAll(job.DestPath, os.ModePerm); err != nil {
+		return "", err
+	}
+	if err := waitForSpace(ctx, job.DestPath, dirSize(d.segmentDir(job))); err != nil {
+		return "", err
+	}
+	tsPath := filepath.Join(job.DestPath, job.Filename) + ".ts"
+	partPath := tsPath + partSuffix
+	if err := d.writeTs(ctx, partPath, job, pl); err != nil {
+		os.Remove(partPath)
+		return "", err
+	}
+	if err := os.Rename(partPath, tsPath); err != nil {
+		os.Remove(partPath)
+		return "", err
+	}
+	if err := os.RemoveAll(d.segmentDir(job)); err != nil {
+		loggerFrom(ctx).Warnf("Failed to remove %s - %v", d.segmentDir(job), err)
+	}
+	return tsPath, nil
+}
+
+func (d *downloader) writeTs(ctx context.Context, tsPath string, job *dlJob, pl *playlist) error {
+	out, err := os.Create(tsPath)
+	if err != nil {
+		return fmt.Errorf("failed to create output ts file - %s - %v", tsPath, err)
+	}
+	defer out.Close()
+
+	keys := map[string][]byte{}
+	for i, seg := range pl.Segments {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		data, err := ioutil.ReadFile(d.segmentTmpPath(job, i))
+		if err != nil {
+			return err
+		}
+		if seg.Key != nil {
+			key, ok := keys[seg.Key.URI]
+			if !ok {
+				if key, err = d.fetchKey(ctx, seg.Key.URI); err != nil {
+					return err
+				}
+				keys[seg.Key.URI] = key
+			}
+			if data, err = decryptSegment(data, key, seg); err != nil {
+				return fmt.Errorf("failed to decrypt segment %d - %v", i, err)
+			}
+		}
+		if _, err = out.Write(data); err != nil {
+			return err
+		}
+	}
+	if err := out.Sync(); err != nil {
+		return err
+	}
+	return out.Close()
+}
+
+func (d *downloader) fetchKey(ctx context.Context, u string) ([]byte, error) {
+	resp, err := httpGet(ctx, d.client, u)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download the encryption key - %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, fmt.Errorf("encryption key response code: %d", resp.StatusCode)
+	}
+	return ioutil.ReadAll(resp.Body)
+}
+
+// segmentDir is the folder where the segments of the job are downloaded.
+func (d *downloader) segmentDir(job *dlJob) string {
+	return filepath.Join(d.tmpDir, job.Filename)
+}
+
+func (d *downloader) segmentTmpPath(job *dlJob, pos int) string {
+	return filepath.Join(d.segmentDir(job), fmt.Sprintf("seg_%d.ts", pos))
+}
+
+// dirSize returns the total size of the files in dir.
+func dirSize(dir string) uint64 {
+	var size uint64
+	files, _ := ioutil.ReadDir(dir)
+	for _, fi := range files {
+		size += uint64(fi.Size())
+	}
+	return size
+}
+
+// decryptSegment decrypts an AES-128 encrypted segment. When the key doesn't
+// have an IV, the media sequence number is used as the IV.
+func decryptSegment(data, key []byte, seg segment) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to use the passed key - %v", err)
+	}
+	iv := seg.Key.IV
+	if len(iv) == 0 {
+		iv = make([]byte, aes.BlockSize)
+		binary.BigEndian.PutUint32(iv[aes.BlockSize-4:], uint32(seg.Sequence))
+	}
+	if len(iv) != aes.BlockSize {
+		return nil, fmt.Errorf("bad IV, should be len %d but is %d", aes.BlockSize, len(iv))
+	}
+	if len(data)%aes.BlockSize != 0 {
+		return nil, fmt.Errorf("encrypted data isn't a multiple of the block size: %d", len(data))
+	}
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(data, data)
+	// remove the PKCS7 padding
+	if n := len(data); n > 0 {
+		pad := int(data[n-1])
+		if pad > 0 && pad <= aes.BlockSize && pad <= n &&
+			bytes.Equal(data[n-pad:], bytes.Repeat([]byte{byte(pad)}, pad)) {
+			data = data[:n-pad]
+		}
+	}
+	return data, nil
+}
+
+// countingReader reports the bytes read to the progress display.
+type countingReader struct {
+	r        io.Reader
+	progress *progress
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.progress.AddBytes(int64(n))
+	return n, err
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"testing"
+)
+
+// encryptSegment encrypts data with AES-128 CBC and PKCS7 padding, the way
+// HLS segments are.
+func encryptSegment(data, key, iv []byte) []byte {
+	pad := aes.BlockSize - len(data)%aes.BlockSize
+	padded := append(append([]byte{}, data...), bytes.Repeat([]byte{byte(pad)}, pad)...)
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		panic(err)
+	}
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(padded, padded)
+	return padded
+}
+
+func TestDecryptSegment(t *testing.T) {
+	key := []byte("0123456789abcdef")
+	iv := []byte("fedcba9876543210")
+	sequenceIV := make([]byte, aes.BlockSize)
+	sequenceIV[14], sequenceIV[15] = 0x01, 0x02
+	plain := bytes.Repeat([]byte("segment data "), 10)
+	aligned := bytes.Repeat([]byte{0x47}, 4*aes.BlockSize)
+
+	tests := []struct {
+		name string
+		data []byte
+		key  []byte
+		seg  segment
+		want []byte
+		err  bool
+	}{
+		{
+			name: "IV of the key",
+			data: encryptSegment(plain, key, iv),
+			key:  key,
+			seg:  segment{Sequence: 5, Key: &segmentKey{IV: iv}},
+			want: plain,
+		},
+		{
+			name: "media sequence as IV",
+			data: encryptSegment(plain, key, sequenceIV),
+			key:  key,
+			seg:  segment{Sequence: 0x0102, Key: &segmentKey{}},
+			want: plain,
+		},
+		{
+			name: "block aligned data",
+			data: encryptSegment(aligned, key, iv),
+			key:  key,
+			seg:  segment{Key: &segmentKey{IV: iv}},
+			want: aligned,
+		},
+		{
+			name: "invalid key",
+			data: encryptSegment(plain, key, iv),
+			key:  key[:5],
+			seg:  segment{Key: &segmentKey{IV: iv}},
+			err:  true,
+		},
+		{
+			name: "invalid IV",
+			data: encryptSegment(plain, key, iv),
+			key:  key,
+			seg:  segment{Key: &segmentKey{IV: iv[:8]}},
+			err:  true,
+		},
+		{
+			name: "truncated data",
+			data: encryptSegment(plain, key, iv)[:20],
+			key:  key,
+			seg:  segment{Key: &segmentKey{IV: iv}},
+			err:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := decryptSegment(tt.data, tt.key, tt.seg)
+			if (err != nil) != tt.err {
+				t.Fatalf("expected error %v, got %v", tt.err, err)
+			}
+			if err == nil && !bytes.Equal(got, tt.want) {
+				t.Errorf("expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
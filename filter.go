@@ -0,0 +1,276 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// airDateLayouts are the formats of the air dates found in the listings.
+var airDateLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02",
+}
+
+// parseAirDate parses an air date, the zero time is returned when it can't
+// be parsed.
+func parseAirDate(s string) time.Time {
+	s = strings.TrimSpace(s)
+	for _, layout := range airDateLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// filterOptions are the episode filters passed on the command line.
+type filterOptions struct {
+	episodes      string
+	newest        int
+	after         string
+	before        string
+	include       string
+	exclude       string
+	freeOnly      bool
+	availableOnly bool
+	extras        bool
+	trailers      bool
+	seasons       string
+	tags          string
+	ratings       string
+}
+
+func (o *filterOptions) register(fs *flag.FlagSet) {
+	fs.StringVar(&o.episodes, "episodes", "", "episodes to download by position in the listing, for instance 1-5,8")
+	fs.StringVar(&o.seasons, "season", "", "only download the episodes of these seasons, for instance 2 or 1-3")
+	fs.IntVar(&o.newest, "newest", 0, "only download the N most recent episodes")
+	fs.StringVar(&o.after, "after", "", "only download the episodes aired on or after this date (YYYY-MM-DD)")
+	fs.StringVar(&o.before, "before", "", "only download the episodes aired before this date (YYYY-MM-DD)")
+	fs.StringVar(&o.include, "include", "", "only download the episodes with a title matching this regular expression")
+	fs.StringVar(&o.exclude, "exclude", "", "skip the episodes with a title matching this regular expression")
+	fs.BoolVar(&o.freeOnly, "free-only", false, "skip the episodes requiring a subscription")
+	fs.BoolVar(&o.availableOnly, "available-only", false, "skip the episodes flagged as unavailable")
+	fs.StringVar(&o.tags, "tag", "", "only download the episodes with one of these comma separated tags (genres, themes...), for instance Jeunesse")
+	fs.StringVar(&o.ratings, "rating", "", "only download the episodes with one of these comma separated ratings, for instance G,8+")
+	fs.BoolVar(&o.extras, "extras", false, "also download the extras (clips, making-of...) to the Extras folder")
+	fs.BoolVar(&o.trailers, "trailers", false, "also download the trailers to the Extras folder")
+}
+
+// filter validates the options and returns the matching filter.
+func (o *filterOptions) filter() (*episodeFilter, error) {
+	f := &episodeFilter{
+		newest:        o.newest,
+		freeOnly:      o.freeOnly,
+		availableOnly: o.availableOnly,
+		extras:        o.extras,
+		trailers:      o.trailers,
+		tags:          splitList(o.tags),
+		ratings:       splitList(o.ratings),
+	}
+	var err error
+	if o.episodes != "" {
+		if f.ranges, err = parseIndexRanges(o.episodes); err != nil {
+			return nil, fmt.Errorf("invalid -episodes - %v", err)
+		}
+	}
+	if o.seasons != "" {
+		if f.seasons, err = parseIndexRanges(o.seasons); err != nil {
+			return nil, fmt.Errorf("invalid -season - %v", err)
+		}
+	}
+	if o.newest < 0 {
+		return nil, fmt.Errorf("invalid -newest %d", o.newest)
+	}
+	if o.after != "" {
+		if f.after, err = time.Parse("2006-01-02", o.after); err != nil {
+			return nil, fmt.Errorf("invalid -after date - %v", err)
+		}
+	}
+	if o.before != "" {
+		if f.before, err = time.Parse("2006-01-02", o.before); err != nil {
+			return nil, fmt.Errorf("invalid -before date - %v", err)
+		}
+	}
+	if o.include != "" {
+		if f.include, err = regexp.Compile(o.include); err != nil {
+			return nil, fmt.Errorf("invalid -include pattern - %v", err)
+		}
+	}
+	if o.exclude != "" {
+		if f.exclude, err = regexp.Compile(o.exclude); err != nil {
+			return nil, fmt.Errorf("invalid -exclude pattern - %v", err)
+		}
+	}
+	return f, nil
+}
+
+// indexRange is an inclusive range of 1-based episode positions or season
+// numbers.
+type indexRange struct {
+	from, to int
+}
+
+// parseIndexRanges parses a list of positions and ranges such as 1-5,8.
+// Open ranges like 10- go to the last episode.
+func parseIndexRanges(s string) ([]indexRange, error) {
+	var ranges []indexRange
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		bounds := strings.SplitN(part, "-", 2)
+		from, err := strconv.Atoi(strings.TrimSpace(bounds[0]))
+		if err != nil || from < 1 {
+			return nil, fmt.Errorf("bad number %q", part)
+		}
+		r := indexRange{from: from, to: from}
+		if len(bounds) == 2 {
+			if end := strings.TrimSpace(bounds[1]); end == "" {
+				r.to = -1
+			} else if r.to, err = strconv.Atoi(end); err != nil || r.to < from {
+				return nil, fmt.Errorf("bad range %q", part)
+			}
+		}
+		ranges = append(ranges, r)
+	}
+	if len(ranges) == 0 {
+		return nil, fmt.Errorf("no numbers in %q", s)
+	}
+	return ranges, nil
+}
+
+// episodeFilter selects the episodes to download among the ones listed for a
+// source.
+type episodeFilter struct {
+	ranges           []indexRange
+	seasons          []indexRange
+	newest           int
+	after, before    time.Time
+	include, exclude *regexp.Regexp
+	freeOnly         bool
+	availableOnly    bool
+	// the extras and trailers are skipped unless asked for
+	extras, trailers bool
+	// tags and ratings are matched ignoring the case
+	tags, ratings []string
+}
+
+// apply returns the 0-based positions of the selected episodes, in listing
+// order. Episodes without an air date are dropped by the date filters.
+func (f *episodeFilter) apply(episodes []Episode) []int {
+	var selected []int
+	for i, ep := range episodes {
+		if f == nil || f.match(i+1, ep) {
+			selected = append(selected, i)
+		}
+	}
+	if f != nil && f.newest > 0 && len(selected) > f.newest {
+		selected = newestEpisodes(episodes, selected, f.newest)
+	}
+	return selected
+}
+
+func (f *episodeFilter) match(pos int, ep Episode) bool {
+	if len(f.ranges) > 0 && !inRanges(f.ranges, pos) {
+		return false
+	}
+	// the episodes without a season number don't belong to any season
+	if len(f.seasons) > 0 && !inRanges(f.seasons, ep.SeasonNumber) {
+		return false
+	}
+	if !f.after.IsZero() && (ep.AirDate.IsZero() || ep.AirDate.Before(f.after)) {
+		return false
+	}
+	if !f.before.IsZero() && (ep.AirDate.IsZero() || !ep.AirDate.Before(f.before)) {
+		return false
+	}
+	if f.include != nil && !f.include.MatchString(ep.Title) {
+		return false
+	}
+	if f.exclude != nil && f.exclude.MatchString(ep.Title) {
+		return false
+	}
+	if f.freeOnly && ep.Paid {
+		return false
+	}
+	if f.availableOnly && ep.Unavailable {
+		return false
+	}
+	if len(f.ratings) > 0 && !containsFold(f.ratings, ep.Rating) {
+		return false
+	}
+	if len(f.tags) > 0 {
+		tagged := false
+		for _, tag := range ep.Tags {
+			tagged = tagged || containsFold(f.tags, tag.Title)
+		}
+		if !tagged {
+			return false
+		}
+	}
+	if ep.Trailer {
+		return f.trailers
+	}
+	if ep.Extra {
+		return f.extras
+	}
+	return true
+}
+
+// splitList splits a comma separated list, dropping the empty elements.
+func splitList(s string) []string {
+	var list []string
+	for _, e := range strings.Split(s, ",") {
+		if e = strings.TrimSpace(e); e != "" {
+			list = append(list, e)
+		}
+	}
+	return list
+}
+
+func containsFold(list []string, s string) bool {
+	for _, e := range list {
+		if strings.EqualFold(e, s) {
+			return true
+		}
+	}
+	return false
+}
+
+func inRanges(ranges []indexRange, n int) bool {
+	for _, r := range ranges {
+		if n >= r.from && (r.to < 0 || n <= r.to) {
+			return true
+		}
+	}
+	return false
+}
+
+// newestEpisodes keeps the n most recent of the selected episodes, in
+// listing order. When some air dates are unknown, the listing is assumed to
+// be chronological.
+func newestEpisodes(episodes []Episode, selected []int, n int) []int {
+	pos := append([]int(nil), selected...)
+	dated := true
+	for _, i := range pos {
+		if episodes[i].AirDate.IsZero() {
+			dated = false
+		}
+	}
+	if dated {
+		sort.SliceStable(pos, func(i, j int) bool {
+			return episodes[pos[i]].AirDate.Before(episodes[pos[j]].AirDate)
+		})
+	}
+	keep := pos[len(pos)-n:]
+	sort.Ints(keep)
+	return keep
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"reflect"
+	"regexp"
+	"testing"
+	"time"
+)
+
+func TestParseIndexRanges(t *testing.T) {
+	tests := []struct {
+		in   string
+		want []indexRange
+		err  bool
+	}{
+		{in: "3", want: []indexRange{{3, 3}}},
+		{in: "1-5,8", want: []indexRange{{1, 5}, {8, 8}}},
+		{in: " 2 - 4 , 7 ", want: []indexRange{{2, 4}, {7, 7}}},
+		{in: "10-", want: []indexRange{{10, -1}}},
+		{in: "1,,2,", want: []indexRange{{1, 1}, {2, 2}}},
+		{in: "4-4", want: []indexRange{{4, 4}}},
+		{in: "", err: true},
+		{in: ",", err: true},
+		{in: "0", err: true},
+		{in: "-3", err: true},
+		{in: "a", err: true},
+		{in: "5-2", err: true},
+		{in: "1-b", err: true},
+	}
+	for _, tt := range tests {
+		got, err := parseIndexRanges(tt.in)
+		if (err != nil) != tt.err {
+			t.Errorf("%q: expected error %v, got %v", tt.in, tt.err, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%q: expected %v, got %v", tt.in, tt.want, got)
+		}
+	}
+}
+
+func date(s string) time.Time {
+	t, err := time.Parse("2006-01-02", s)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+func TestEpisodeFilterApply(t *testing.T) {
+	episodes := []Episode{
+		{Title: "Le départ", AirDate: date("2020-01-06")},
+		{Title: "La forêt", AirDate: date("2020-01-13"), Paid: true},
+		{Title: "Bande-annonce", AirDate: date("2020-01-20")},
+		{Title: "La rivière", AirDate: date("2020-01-27"), Unavailable: true},
+		{Title: "Le retour"},
+	}
+	tests := []struct {
+		name   string
+		filter *episodeFilter
+		want   []int
+	}{
+		{"no filter", nil, []int{0, 1, 2, 3, 4}},
+		{"empty filter", &episodeFilter{}, []int{0, 1, 2, 3, 4}},
+		{"positions", &episodeFilter{ranges: []indexRange{{1, 2}, {5, 5}}}, []int{0, 1, 4}},
+		{"open range", &episodeFilter{ranges: []indexRange{{4, -1}}}, []int{3, 4}},
+		{"after", &episodeFilter{after: date("2020-01-20")}, []int{2, 3}},
+		{"before", &episodeFilter{before: date("2020-01-20")}, []int{0, 1}},
+		{"between", &episodeFilter{after: date("2020-01-10"), before: date("2020-01-25")}, []int{1, 2}},
+		{"include", &episodeFilter{include: regexp.MustCompile(`^La `)}, []int{1, 3}},
+		{"exclude", &episodeFilter{exclude: regexp.MustCompile(`(?i)bande-annonce`)}, []int{0, 1, 3, 4}},
+		{"free only", &episodeFilter{freeOnly: true}, []int{0, 2, 3, 4}},
+		{"available only", &episodeFilter{availableOnly: true}, []int{0, 1, 2, 4}},
+		{"combined", &episodeFilter{ranges: []indexRange{{1, 4}}, freeOnly: true, availableOnly: true}, []int{0, 2}},
+		{"newest", &episodeFilter{newest: 2}, []int{3, 4}},
+		{"newest after filtering", &episodeFilter{newest: 2, freeOnly: true, availableOnly: true}, []int{2, 4}},
+		{"newest more than listed", &episodeFilter{newest: 10}, []int{0, 1, 2, 3, 4}},
+		{"newest dated", &episodeFilter{newest: 2, before: date("2021-01-01")}, []int{2, 3}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.filter.apply(episodes); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestNewestEpisodes(t *testing.T) {
+	tests := []struct {
+		name     string
+		episodes []Episode
+		selected []int
+		n        int
+		want     []int
+	}{
+		{
+			name: "sorted by air date, kept in listing order",
+			episodes: []Episode{
+				{AirDate: date("2020-03-01")},
+				{AirDate: date("2020-01-01")},
+				{AirDate: date("2020-04-01")},
+				{AirDate: date("2020-02-01")},
+			},
+			selected: []int{0, 1, 2, 3},
+			n:        2,
+			want:     []int{0, 2},
+		},
+		{
+			name: "unknown dates use the listing order",
+			episodes: []Episode{
+				{AirDate: date("2020-03-01")},
+				{},
+				{AirDate: date("2020-01-01")},
+			},
+			selected: []int{0, 1, 2},
+			n:        2,
+			want:     []int{1, 2},
+		},
+		{
+			name: "only the selected episodes",
+			episodes: []Episode{
+				{AirDate: date("2020-04-01")},
+				{AirDate: date("2020-01-01")},
+				{AirDate: date("2020-02-01")},
+				{AirDate: date("2020-03-01")},
+			},
+			selected: []int{1, 2, 3},
+			n:        1,
+			want:     []int{3},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := newestEpisodes(tt.episodes, tt.selected, tt.n); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestFilterOptions(t *testing.T) {
+	tests := []struct {
+		name string
+		opts filterOptions
+		err  bool
+	}{
+		{"defaults", filterOptions{}, false},
+		{"valid", filterOptions{episodes: "1-3", newest: 2, after: "2020-01-01", before: "2021-01-01", include: "^É", exclude: "x"}, false},
+		{"bad episodes", filterOptions{episodes: "3-1"}, true},
+		{"negative newest", filterOptions{newest: -1}, true},
+		{"bad after", filterOptions{after: "01/02/2020"}, true},
+		{"bad before", filterOptions{before: "2020-13-01"}, true},
+		{"bad include", filterOptions{include: "("}, true},
+		{"bad exclude", filterOptions{exclude: "["}, true},
+	}
+	for _, tt := range tests {
+		if _, err := tt.opts.filter(); (err != nil) != tt.err {
+			t.Errorf("%s: expected error %v, got %v", tt.name, tt.err, err)
+		}
+	}
+}
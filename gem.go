@@ -0,0 +1,221 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const (
+	gemCatalogURL = "https://services.radio-canada.ca/ott/catalog/v2/gem/show/%s?device=web"
+)
+
+// gemEpisodeKey matches the episode part of a Gem URL, for instance s01e02.
+var gemEpisodeKey = regexp.MustCompile(`^s\d+e\d+$`)
+
+func init() {
+	registerProvider(&gemProvider{})
+}
+
+// gemProvider handles the CBC Gem (English) shows and episodes, for instance:
+// https://gem.cbc.ca/media/schitts-creek or https://gem.cbc.ca/schitts-creek/s01e01
+type gemProvider struct{}
+
+func (p *gemProvider) Name() string {
+	return "cbc-gem"
+}
+
+func (p *gemProvider) Match(u *url.URL) bool {
+	return u.Host == "gem.cbc.ca" || u.Host == "www.gem.cbc.ca"
+}
+
+// ListShow lists the episodes of all the seasons of the show. If the URL
+// points to an episode, only that episode is returned.
+func (p *gemProvider) ListShow(ctx context.Context, u *url.URL) (*Show, error) {
+	slug, episode := p.parsePath(u.Path)
+	if slug == "" {
+		return nil, fmt.Errorf("no show found in %s", u)
+	}
+	data, err := p.show(ctx, slug)
+	if err != nil {
+		return nil, err
+	}
+
+	show := &Show{ID: slug, Title: data.Title, URL: p.itemURL(slug), Description: data.Description}
+	for _, content := range data.Content {
+		for _, lineup := range content.Lineups {
+			for _, item := range lineup.Items {
+				if item.IDMedia == "" {
+					continue
+				}
+				if episode != "" && p.itemKey(item.URL) != episode {
+					continue
+				}
+				ep := p.episode(item)
+				if ep.SeasonNumber == 0 {
+					ep.SeasonNumber = lineup.SeasonNumber
+				}
+				show.add(ep)
+				if season := show.season(ep.SeasonNumber); season.Title == "" {
+					season.Title = lineup.Title
+				}
+			}
+		}
+	}
+	return show, nil
+}
+
+// episode maps a catalogue item to an episode.
+func (p *gemProvider) episode(item GemItemJSON) Episode {
+	return Episode{
+		Title:         item.Title,
+		URL:           p.itemURL(item.URL),
+		IDMedia:       string(item.IDMedia),
+		AppCode:       gemAppCode,
+		SeasonNumber:  item.SeasonNumber,
+		EpisodeNumber: item.EpisodeNumber,
+		Description:   item.Description,
+		ImageURL:      item.Images.Card.URL,
+		Duration:      time.Duration(item.Duration) * time.Second,
+	}
+}
+
+// Metadata looks the episode up in the show's catalogue.
+func (p *gemProvider) Metadata(ctx context.Context, ep Episode) (*Episode, error) {
+	u, err := url.Parse(ep.URL)
+	if err != nil {
+		return nil, err
+	}
+	slug, episode := p.parsePath(u.Path)
+	show, err := p.show(ctx, slug)
+	if err != nil {
+		return nil, err
+	}
+	for _, content := range show.Content {
+		for _, lineup := range content.Lineups {
+			for _, item := range lineup.Items {
+				if p.itemKey(item.URL) != episode {
+					continue
+				}
+				md := p.episode(item)
+				return &md, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("episode %s not found in the %s catalogue", episode, slug)
+}
+
+func (p *gemProvider) ResolveMedia(ctx context.Context, ep Episode) (*MediaStream, error) {
+	id := ep.IDMedia
+	if id == "" {
+		md, err := p.Metadata(ctx, ep)
+		if err != nil {
+			return nil, err
+		}
+		id = md.IDMedia
+	}
+	return rccMediaStream(ctx, id, validationParams{AppCode: gemAppCode})
+}
+
+func (p *gemProvider) show(ctx context.Context, slug string) (*GemShowJSON, error) {
+	res, err := httpGet(ctx, http.DefaultClient, fmt.Sprintf(gemCatalogURL, url.PathEscape(slug)))
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != 200 {
+		return nil, fmt.Errorf("status code error: %d %s", res.StatusCode, res.Status)
+	}
+	var data GemShowJSON
+	if err = json.NewDecoder(res.Body).Decode(&data); err != nil {
+		return nil, fmt.Errorf("failed to parse the Gem catalogue - %v", err)
+	}
+	return &data, nil
+}
+
+// parsePath extracts the show slug and the optional episode key from the
+// path of a Gem URL.
+func (p *gemProvider) parsePath(path string) (slug, episode string) {
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	if len(parts) > 0 && parts[0] == "media" {
+		parts = parts[1:]
+	}
+	if len(parts) == 0 {
+		return "", ""
+	}
+	slug = parts[0]
+	if len(parts) > 1 && gemEpisodeKey.MatchString(strings.ToLower(parts[1])) {
+		episode = strings.ToLower(parts[1])
+	}
+	return slug, episode
+}
+
+// itemKey returns the episode key of a catalogue item URL.
+func (p *gemProvider) itemKey(itemURL string) string {
+	_, episode := p.parsePath(strings.TrimPrefix(itemURL, "https://gem.cbc.ca"))
+	return episode
+}
+
+func (p *gemProvider) itemURL(path string) string {
+	if strings.HasPrefix(path, "http") {
+		return path
+	}
+	return "https://gem.cbc.ca/" + strings.TrimPrefix(path, "/")
+}
+
+// GemShowJSON is the JSON structure of a show in the Gem catalogue.
+type GemShowJSON struct {
+	ID          string `json:"id"`
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	Content     []struct {
+		Title   string `json:"title"`
+		Lineups []struct {
+			Title        string        `json:"title"`
+			SeasonNumber int           `json:"seasonNumber"`
+			Items        []GemItemJSON `json:"items"`
+		} `json:"lineups"`
+	} `json:"content"`
+}
+
+// GemItemJSON is an episode of the Gem catalogue.
+type GemItemJSON struct {
+	Title         string     `json:"title"`
+	URL           string     `json:"url"`
+	IDMedia       flexibleID `json:"idMedia"`
+	Description   string     `json:"description"`
+	SeasonNumber  int        `json:"seasonNumber"`
+	EpisodeNumber int        `json:"episodeNumber"`
+	Duration      int        `json:"duration"`
+	Images        struct {
+		Card struct {
+			URL string `json:"url"`
+		} `json:"card"`
+	} `json:"images"`
+}
+
+// flexibleID is an identifier that can be encoded as a JSON string or
+// number.
+type flexibleID string
+
+func (id *flexibleID) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		return nil
+	}
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		*id = flexibleID(s)
+		return nil
+	}
+	var n json.Number
+	if err := json.Unmarshal(data, &n); err != nil {
+		return err
+	}
+	*id = flexibleID(n.String())
+	return nil
+}
@@ -8,4 +8,5 @@ require (
 	github.com/hailiang/gosocks v0.0.0-20141219140937-b913be938dea
 	github.com/mattetti/m3u8Grabber v0.0.0-20180526172854-7e0a3554aa57
 	golang.org/x/net v0.0.0-20180418062111-d41e8174641f
+	golang.org/x/text v0.3.6
 )
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+var (
+	// infoMediaIDPatterns find the media ids in the player configurations
+	// embedded in the news pages.
+	infoMediaIDPatterns = []*regexp.Regexp{
+		regexp.MustCompile(`"idMedia"\s*:\s*"?(\d+)"?`),
+		regexp.MustCompile(`data-idmedia="(\d+)"`),
+		regexp.MustCompile(`data-media-id="(\d+)"`),
+	}
+	// infoURLMediaID finds the media id in the URL of an Info video page.
+	// It isn't applied to the page content since the related videos are
+	// linked the same way.
+	infoURLMediaID     = regexp.MustCompile(`/videos/media-(\d+)`)
+	infoAppCodePattern = regexp.MustCompile(`"appCode"\s*:\s*"(\w+)"`)
+)
+
+func init() {
+	registerProvider(&infoProvider{})
+}
+
+// infoProvider handles the Radio-Canada news articles and Info video pages,
+// including the regional ones. Every video embedded in the page is listed,
+// for instance:
+// https://ici.radio-canada.ca/info/videos/media-8012345/reportage
+// https://ici.radio-canada.ca/nouvelle/1234567/titre-de-l-article
+type infoProvider struct{}
+
+func (p *infoProvider) Name() string {
+	return "radio-canada-info"
+}
+
+func (p *infoProvider) Match(u *url.URL) bool {
+	return u.Host == "ici.radio-canada.ca" && !strings.HasPrefix(u.Path, "/jeunesse/")
+}
+
+// ListShow returns the videos embedded in the page, named after the
+// article.
+func (p *infoProvider) ListShow(ctx context.Context, u *url.URL) (*Show, error) {
+	page, err := p.fetch(ctx, u.String())
+	if err != nil {
+		return nil, err
+	}
+	if len(page.mediaIDs) == 0 {
+		return nil, fmt.Errorf("no video found in %s", u)
+	}
+	show := &Show{Title: page.title, URL: u.String(), ImageURL: page.imageURL}
+	for i, id := range page.mediaIDs {
+		title := page.title
+		if len(page.mediaIDs) > 1 {
+			title = fmt.Sprintf("%s - %d", page.title, i+1)
+		}
+		show.add(Episode{Title: title, URL: u.String(), IDMedia: id, AppCode: page.appCode, ImageURL: page.imageURL})
+	}
+	return show, nil
+}
+
+// Metadata returns the first video of the page unless the media id is
+// already known.
+func (p *infoProvider) Metadata(ctx context.Context, ep Episode) (*Episode, error) {
+	page, err := p.fetch(ctx, ep.URL)
+	if err != nil {
+		return nil, err
+	}
+	md := &Episode{Title: page.title, IDMedia: ep.IDMedia, AppCode: page.appCode, ImageURL: page.imageURL}
+	if md.IDMedia == "" {
+		if len(page.mediaIDs) == 0 {
+			return nil, fmt.Errorf("no video found in %s", ep.URL)
+		}
+		md.IDMedia = page.mediaIDs[0]
+	}
+	return md, nil
+}
+
+func (p *infoProvider) ResolveMedia(ctx context.Context, ep Episode) (*MediaStream, error) {
+	if ep.IDMedia != "" {
+		return rccMediaStream(ctx, ep.IDMedia, validationParams{AppCode: ep.AppCode})
+	}
+	md, err := p.Metadata(ctx, ep)
+	if err != nil {
+		return nil, err
+	}
+	return rccMediaStream(ctx, md.IDMedia, validationParams{AppCode: md.AppCode})
+}
+
+// infoPage is what we extract from a news page.
+type infoPage struct {
+	title    string
+	imageURL string
+	appCode  string
+	mediaIDs []string
+}
+
+func (p *infoProvider) fetch(ctx context.Context, u string) (*infoPage, error) {
+	res, err := httpGet(ctx, http.DefaultClient, u)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != 200 {
+		return nil, fmt.Errorf("status code error: %d %s", res.StatusCode, res.Status)
+	}
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+	doc, err := goquery.NewDocumentFromReader(bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+
+	page := &infoPage{appCode: medianetAppCode}
+	page.title, _ = doc.Find(`meta[property="og:title"]`).Attr("content")
+	if page.title == "" {
+		page.title = doc.Find("h1").First().Text()
+	}
+	if page.title == "" {
+		page.title = doc.Find("title").First().Text()
+	}
+	page.title = strings.TrimSpace(page.title)
+	page.imageURL, _ = doc.Find(`meta[property="og:image"]`).Attr("content")
+	if m := infoAppCodePattern.FindSubmatch(body); m != nil {
+		page.appCode = string(m[1])
+	}
+	if m := infoURLMediaID.FindStringSubmatch(u); m != nil {
+		page.mediaIDs = append(page.mediaIDs, m[1])
+	}
+	for _, id := range extractMediaIDs(body) {
+		if len(page.mediaIDs) == 0 || id != page.mediaIDs[0] {
+			page.mediaIDs = append(page.mediaIDs, id)
+		}
+	}
+	if page.title == "" && len(page.mediaIDs) > 0 {
+		page.title = "media-" + page.mediaIDs[0]
+	}
+	return page, nil
+}
+
+// extractMediaIDs returns the unique media ids found in the content, in
+// order of appearance.
+func extractMediaIDs(content []byte) []string {
+	type match struct {
+		pos int
+		id  string
+	}
+	var matches []match
+	for _, re := range infoMediaIDPatterns {
+		for _, m := range re.FindAllSubmatchIndex(content, -1) {
+			matches = append(matches, match{pos: m[0], id: string(content[m[2]:m[3]])})
+		}
+	}
+	// order by position in the page so the numbering follows the article
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].pos < matches[j].pos
+	})
+	seen := map[string]bool{}
+	var ids []string
+	for _, m := range matches {
+		if !seen[m.id] {
+			seen[m.id] = true
+			ids = append(ids, m.id)
+		}
+	}
+	return ids
+}
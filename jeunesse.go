@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+func init() {
+	registerProvider(&jeunesseProvider{})
+}
+
+// jeunesseProvider handles the Radio-Canada jeunesse shows, for instance:
+// https://ici.radio-canada.ca/jeunesse/scolaire/emissions/5462/trullalleri/contenu/videos/accueil
+type jeunesseProvider struct{}
+
+func (p *jeunesseProvider) Name() string {
+	return "radio-canada-jeunesse"
+}
+
+func (p *jeunesseProvider) Match(u *url.URL) bool {
+	return u.Host == "ici.radio-canada.ca" && strings.HasPrefix(u.Path, "/jeunesse/")
+}
+
+func (p *jeunesseProvider) ListShow(ctx context.Context, u *url.URL) (*Show, error) {
+	res, err := httpGet(ctx, http.DefaultClient, u.String())
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != 200 {
+		return nil, fmt.Errorf("status code error: %d %s", res.StatusCode, res.Status)
+	}
+
+	// Load the HTML document
+	doc, err := goquery.NewDocumentFromReader(res.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	show := &Show{URL: u.String()}
+	var link string
+	// Find the review items
+	doc.Find(".medianet-content").Each(func(i int, s *goquery.Selection) {
+		// For each item found, get the band and title
+		link, _ = s.Attr("href")
+		if len(link) > 0 && link[0] == '/' {
+			link = fmt.Sprintf("https://%s%s", res.Request.URL.Host, link)
+		}
+		if len(link) > 0 {
+			title := strings.TrimSpace(s.ChildrenFiltered("div.vigette-content-info").ChildrenFiltered("h3.title").Text())
+			show.add(Episode{Title: title, URL: link, ID: jeunesseEpisodeID(link)})
+		}
+	})
+	return show, nil
+}
+
+// jeunesseEpisodePath matches the id of an episode in its URL, for instance
+// /jeunesse/scolaire/emissions/1080/mouss-boubidi/episodes/367664/hulla-hop-hop-hop/emission
+var jeunesseEpisodePath = regexp.MustCompile(`/episodes/(\d+)(?:/|$)`)
+
+// jeunesseEpisodeID returns the id of the episode in its URL, empty when the
+// URL doesn't have one.
+func jeunesseEpisodeID(link string) string {
+	if m := jeunesseEpisodePath.FindStringSubmatch(link); m != nil {
+		return m[1]
+	}
+	return ""
+}
+
+// jeunesseShowPath matches the id and slug of a show in the path following
+// the section, for instance 5462/trullalleri.
+var jeunesseShowPath = regexp.MustCompile(`^(\d+)/([\w-]+)(?:/|$)`)
+
+// showPage returns the videos page of the show linked from the section
+// index, for instance the section /jeunesse/scolaire/emissions links to
+// /jeunesse/scolaire/emissions/5462/trullalleri.
+func (p *jeunesseProvider) showPage(section, link *url.URL) (string, bool) {
+	prefix := strings.TrimSuffix(section.Path, "/") + "/"
+	if link.Host != section.Host || !strings.HasPrefix(link.Path, prefix) {
+		return "", false
+	}
+	m := jeunesseShowPath.FindStringSubmatch(strings.TrimPrefix(link.Path, prefix))
+	if m == nil {
+		return "", false
+	}
+	return fmt.Sprintf("https://%s%s%s/%s/contenu/videos/accueil", link.Host, prefix, m[1], m[2]), true
+}
+
+// Metadata reads the player configuration embedded in the episode's page.
+func (p *jeunesseProvider) Metadata(ctx context.Context, ep Episode) (*Episode, error) {
+	loggerFrom(ctx).Debugf("Reading the episode page %s", ep.URL)
+	res, err := httpGet(ctx, http.DefaultClient, ep.URL)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != 200 {
+		return nil, fmt.Errorf("status code error: %d %s", res.StatusCode, res.Status)
+	}
+
+	doc, err := goquery.NewDocumentFromReader(res.Body)
+	if err != nil {
+		return nil, err
+	}
+	s := doc.Find("#jeunesse-video-media").First()
+	val := s.Text()
+
+	var data RCCEpisodeJSON
+	if err = json.Unmarshal([]byte(val), &data); err != nil {
+		return nil, err
+	}
+	return &Episode{
+		Title:    ep.Title,
+		URL:      ep.URL,
+		ID:       ep.ID,
+		IDMedia:  data.IDMedia,
+		AppCode:  data.AppCode,
+		ImageURL: data.Params.URLTeaser,
+	}, nil
+}
+
+func (p *jeunesseProvider) ResolveMedia(ctx context.Context, ep Episode) (*MediaStream, error) {
+	md, err := p.Metadata(ctx, ep)
+	if err != nil {
+		return nil, err
+	}
+	return rccMediaStream(ctx, md.IDMedia, validationParams{AppCode: md.AppCode})
+}
+
+// RCCEpisodeJSON is the JSON structure for the show information available in
+// the episode's page.
+type RCCEpisodeJSON struct {
+	AppCode string `json:"appCode"`
+	IDMedia string `json:"idMedia"`
+	Params  struct {
+		AutoPlay       bool   `json:"autoPlay"`
+		CanExtract     bool   `json:"canExtract"`
+		CanFullScreen  bool   `json:"canFullScreen"`
+		Gui            string `json:"gui"`
+		Height         string `json:"height"`
+		ID             string `json:"id"`
+		InfoBar        bool   `json:"infoBar"`
+		IsNextable     bool   `json:"isNextable"`
+		IsPreviousable bool   `json:"isPreviousable"`
+		Lang           string `json:"lang"`
+		Next           bool   `json:"next"`
+		Previous       bool   `json:"previous"`
+		Share          bool   `json:"share"`
+		Time           string `json:"time"`
+		URLTeaser      string `json:"urlTeaser"`
+		Width          string `json:"width"`
+	} `json:"params"`
+}
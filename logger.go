@@ -0,0 +1,210 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// logLevel is the severity of a log entry, the higher the more verbose.
+type logLevel int
+
+const (
+	levelError logLevel = iota
+	levelWarn
+	levelInfo
+	levelDebug
+	levelTrace
+)
+
+var levelNames = []string{"error", "warn", "info", "debug", "trace"}
+
+func (lvl logLevel) String() string {
+	return levelNames[lvl]
+}
+
+func parseLogLevel(s string) (logLevel, error) {
+	for i, name := range levelNames {
+		if strings.EqualFold(s, name) {
+			return logLevel(i), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown log level %q, use one of %s", s, strings.Join(levelNames, ", "))
+}
+
+// logger writes levelled entries with structured fields, as text or as one
+// JSON object per line. Loggers derived with With share the same output.
+type logger struct {
+	out    *logOutput
+	fields []logField
+}
+
+type logField struct {
+	key   string
+	value interface{}
+}
+
+// logOutput is the destination shared by a logger and the loggers derived
+// from it.
+type logOutput struct {
+	mu    sync.Mutex
+	w     io.Writer
+	level logLevel
+	json  bool
+	// progress, when set, is suspended while an entry is written so the
+	// progress bars aren't garbled.
+	progress *progress
+}
+
+// defaultLogger is used when the context doesn't carry a logger, it is
+// configured from the flags.
+var defaultLogger = newLogger(os.Stderr, levelInfo, false)
+
+func newLogger(w io.Writer, level logLevel, json bool) *logger {
+	return &logger{out: &logOutput{w: w, level: level, json: json}}
+}
+
+type loggerKey struct{}
+
+// withLogger returns a context carrying the logger.
+func withLogger(ctx context.Context, l *logger) context.Context {
+	return context.WithValue(ctx, loggerKey{}, l)
+}
+
+// loggerFrom returns the logger carried by the context, the default logger
+// otherwise.
+func loggerFrom(ctx context.Context) *logger {
+	if l, ok := ctx.Value(loggerKey{}).(*logger); ok {
+		return l
+	}
+	return defaultLogger
+}
+
+// With returns a logger adding the key/value pairs to every entry.
+func (l *logger) With(keyValues ...interface{}) *logger {
+	fields := make([]logField, len(l.fields), len(l.fields)+len(keyValues)/2)
+	copy(fields, l.fields)
+	for i := 0; i+1 < len(keyValues); i += 2 {
+		fields = append(fields, logField{key: fmt.Sprint(keyValues[i]), value: keyValues[i+1]})
+	}
+	return &logger{out: l.out, fields: fields}
+}
+
+// Enabled reports whether entries of the level are written.
+func (l *logger) Enabled(level logLevel) bool {
+	return level <= l.out.level
+}
+
+// setProgress routes the entries through the progress display, nil stops
+// doing so.
+func (l *logger) setProgress(p *progress) {
+	l.out.mu.Lock()
+	defer l.out.mu.Unlock()
+	l.out.progress = p
+}
+
+func (l *logger) Errorf(format string, args ...interface{}) { l.logf(levelError, format, args...) }
+func (l *logger) Warnf(format string, args ...interface{})  { l.logf(levelWarn, format, args...) }
+func (l *logger) Infof(format string, args ...interface{})  { l.logf(levelInfo, format, args...) }
+func (l *logger) Debugf(format string, args ...interface{}) { l.logf(levelDebug, format, args...) }
+func (l *logger) Tracef(format string, args ...interface{}) { l.logf(levelTrace, format, args...) }
+
+// Fatalf logs an error and exits.
+func (l *logger) Fatalf(format string, args ...interface{}) {
+	l.logf(levelError, format, args...)
+	os.Exit(exitFatal)
+}
+
+func (l *logger) logf(level logLevel, format string, args ...interface{}) {
+	if !l.Enabled(level) {
+		return
+	}
+	msg := strings.TrimRight(fmt.Sprintf(format, args...), "\n")
+	var line string
+	if l.out.json {
+		line = l.jsonLine(level, msg)
+	} else {
+		line = l.textLine(level, msg)
+	}
+
+	l.out.mu.Lock()
+	defer l.out.mu.Unlock()
+	write := func() { io.WriteString(l.out.w, line) }
+	if l.out.progress != nil {
+		l.out.progress.Suspend(write)
+	} else {
+		write()
+	}
+}
+
+// textLine formats the entry for humans, the level is only shown when it
+// isn't info. The fields are only shown in debug mode to keep the
+// interactive runs readable.
+func (l *logger) textLine(level logLevel, msg string) string {
+	var b strings.Builder
+	if level != levelInfo {
+		b.WriteString(level.String() + ": ")
+	}
+	b.WriteString(msg)
+	if l.out.level < levelDebug {
+		b.WriteByte('\n')
+		return b.String()
+	}
+	for _, f := range l.fields {
+		value := fmt.Sprint(fieldValue(f.value))
+		if strings.ContainsAny(value, " \t\"=") || value == "" {
+			value = fmt.Sprintf("%q", value)
+		}
+		fmt.Fprintf(&b, " %s=%s", f.key, value)
+	}
+	b.WriteByte('\n')
+	return b.String()
+}
+
+func (l *logger) jsonLine(level logLevel, msg string) string {
+	var b strings.Builder
+	writeJSONField(&b, "time", time.Now().Format(time.RFC3339Nano))
+	b.WriteByte(',')
+	writeJSONField(&b, "level", level.String())
+	b.WriteByte(',')
+	writeJSONField(&b, "msg", msg)
+	for _, f := range l.fields {
+		b.WriteByte(',')
+		writeJSONField(&b, f.key, fieldValue(f.value))
+	}
+	return "{" + b.String() + "}\n"
+}
+
+func writeJSONField(b *strings.Builder, key string, value interface{}) {
+	b.WriteString(jsonValue(key))
+	b.WriteByte(':')
+	b.WriteString(jsonValue(value))
+}
+
+// jsonValue encodes v without escaping the HTML characters, values that
+// can't be encoded are written as strings.
+func jsonValue(v interface{}) string {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		buf.Reset()
+		enc.Encode(fmt.Sprint(v))
+	}
+	return strings.TrimSuffix(buf.String(), "\n")
+}
+
+// fieldValue turns the errors into their message so they are readable in
+// both formats.
+func fieldValue(v interface{}) interface{} {
+	if err, ok := v.(error); ok {
+		return err.Error()
+	}
+	return v
+}
@@ -1,526 +1,382 @@
 package main
 
 import (
-	"encoding/json"
+	"context"
+	"flag"
 	"fmt"
-	"io/ioutil"
-	"log"
 	"net/http"
 	"os"
-	"strings"
-	"sync"
-	"time"
-
-	"github.com/mattetti/m3u8Grabber/m3u8"
-
-	"github.com/PuerkitoBio/goquery"
+	"path/filepath"
 )
 
 var (
-	Debug bool
+	// Converter is the backend used to convert the downloaded ts files to
+	// mp4: auto, native or ffmpeg.
+	Converter string
 )
 
-const (
-	presentationURL = "https://ici.tou.tv/presentation/"
-)
-
-type dlLink struct {
-	Title string
-	URL   string
-}
+// extrasDir is the folder, in the destination, where the extras are saved.
+const extrasDir = "Extras"
 
 func main() {
-	if len(os.Args) < 2 {
-		log.Println("You need to pass the url of the show to download")
+	flag.StringVar(&Converter, "converter", "auto", "ts to mp4 converter: auto, native (built-in remuxer) or ffmpeg")
+	batchFile := flag.String("batch-file", "", "file listing the show, episode or media URLs to download, one per line (- for stdin)")
+	list := flag.Bool("list", false, "list the selected episodes without downloading them")
+	dryRun := flag.Bool("dry-run", false, "resolve the episodes and print what would be downloaded without downloading anything")
+	interactive := flag.Bool("interactive", false, "choose the episodes to download from the listing")
+	filterOpts := &filterOptions{}
+	filterOpts.register(flag.CommandLine)
+	flag.StringVar(&LowSpacePolicy, "low-space", "abort", "what to do when the disk runs low on space: abort or pause until space is freed")
+	fsProfile := flag.String("fs-profile", "windows", "filesystem the file names must be valid on: windows (also for NAS shares), macos or linux")
+	transliterate := flag.Bool("transliterate", false, "remove the accents from the file names and drop the other non ASCII characters")
+	logLevelName := flag.String("log-level", "info", "log verbosity: error, warn, info, debug or trace")
+	logJSON := flag.Bool("log-json", false, "write the logs as JSON lines")
+	reportPath := flag.String("report", "", "write the summary of the run as JSON to this file")
+	flag.StringVar(&ValidationOverrides.DeviceType, "device-type", "", "device type asked to the validation service (ipad, androidams...), disables the fallback devices")
+	flag.StringVar(&ValidationOverrides.ConnectionType, "connection-type", "", "connection type asked to the validation service (broadband, hd, wifi...)")
+	flag.StringVar(&ValidationOverrides.Multibitrate, "multibitrate", "", "ask the validation service for a multi bitrate playlist: true or false")
+	flag.StringVar(&ValidationOverrides.AppCode, "validation-app-code", "", "application code used for every media, instead of the one of the provider or item")
+	flag.Usage = usage
+	flag.Parse()
+	if flag.NArg() < 1 && *batchFile == "" {
+		usage()
 		os.Exit(1)
 	}
-
-	// os.Args[1]
-	passedURL := os.Args[1] // example: "https://ici.radio-canada.ca/jeunesse/scolaire/emissions/1080/mouss-boubidi/episodes/367664/hulla-hop-hop-hop/emission"
-	urls, err := listRCCEpisodesFromURL(passedURL)
+	level, err := parseLogLevel(*logLevelName)
 	if err != nil {
-		log.Fatalf("Something went wrong when fetching the URL - %v", err)
+		defaultLogger.Fatalf("%v", err)
 	}
+	defaultLogger = newLogger(os.Stderr, level, *logJSON)
+	l := defaultLogger
+	filter, err := filterOpts.filter()
+	if err != nil {
+		l.Fatalf("%v", err)
+	}
+	if filenames, err = newFilenameSanitizer(*fsProfile, *transliterate); err != nil {
+		l.Fatalf("%v", err)
+	}
+	if LowSpacePolicy != "abort" && LowSpacePolicy != "pause" {
+		l.Fatalf("invalid -low-space %q, use abort or pause", LowSpacePolicy)
+	}
+	if m := ValidationOverrides.Multibitrate; m != "" && m != "true" && m != "false" {
+		l.Fatalf("invalid -multibitrate %q, use true or false", m)
+	}
+	if *interactive && *batchFile == "-" {
+		l.Fatalf("-interactive reads the selection from stdin, it can't be used with -batch-file -")
+	}
+	ctx, interrupted := notifyContext()
+	// requests aren't paced unless the crawl command sets a delay
+	ctx = withPacer(ctx, &requestPacer{})
 
-	w := &sync.WaitGroup{}
-	stopChan := make(chan bool)
-	m3u8.LaunchWorkers(w, stopChan)
-
-	m3u8.Debug = true
-	var url string
-	for _, u := range urls {
-		if url, err = downloadRCCShowURL(u.URL); err != nil {
-			log.Printf("Failed to download %s - %v\n", u, err)
+	summary := newRunSummary()
+	var queue []queueItem
+	switch flag.Arg(0) {
+	case "media":
+		if queue, err = mediaQueue(ctx, flag.Args()[1:], filter, summary); err != nil {
+			l.Fatalf("%v", err)
 		}
-		if fileExists(fmt.Sprintf("%s.mp4", u.Title)) {
-			log.Printf("%s already downloaded\n", u.Title)
-			continue
+	case "crawl":
+		var download bool
+		if queue, download, err = crawlQueue(ctx, flag.Args()[1:], filter, summary); err != nil {
+			l.Fatalf("%v", err)
 		}
-		fmt.Printf("-> Downloading %s | %s\n", u.Title, u.URL)
-		job := &m3u8.WJob{
-			Type:          m3u8.ListDL,
-			URL:           url,
-			SkipConverter: false,
-			DestPath:      ".",
-			Filename:      u.Title}
-		m3u8.DlChan <- job
-	}
-	time.Sleep(30 * time.Second)
-	close(m3u8.DlChan)
-	w.Wait()
-}
+		if !download && !*list {
+			exitListing(summary, interrupted())
+		}
+	case "retry":
+		if queue, err = retryQueue(ctx, flag.Args()[1:], summary); err != nil {
+			l.Fatalf("%v", err)
+		}
+	default:
+		// example: "https://ici.radio-canada.ca/jeunesse/scolaire/emissions/1080/mouss-boubidi/episodes/367664/hulla-hop-hop-hop/emission"
+		sources := flag.Args()
+		if *batchFile != "" {
+			lines, err := readBatchFile(*batchFile)
+			if err != nil {
+				l.Fatalf("Failed to read the batch file - %v", err)
+			}
+			sources = append(sources, lines...)
+		}
+		queue = buildQueue(ctx, sources, filter, summary)
+	}
+	disambiguateQueue(ctx, queue)
 
-func downloadRCCShowURL(u string) (string, error) {
-	if Debug {
-		log.Printf("Downloading show from %s\n", u)
+	if *list {
+		printQueue(os.Stdout, queue)
+		exitListing(summary, interrupted())
 	}
-	res, err := http.Get(u)
-	if err != nil {
-		return "", err
+	if *interactive && ctx.Err() == nil {
+		picked, err := pickEpisodes(os.Stdin, os.Stdout, queue)
+		if err != nil {
+			l.Fatalf("%v", err)
+		}
+		summary.deselect(queue, picked)
+		queue = picked
 	}
-	defer res.Body.Close()
-	if res.StatusCode != 200 {
-		return "", fmt.Errorf("status code error: %d %s", res.StatusCode, res.Status)
+	if *dryRun {
+		planDownloads(ctx, os.Stdout, queue)
+		exitListing(summary, interrupted())
 	}
-
-	doc, err := goquery.NewDocumentFromReader(res.Body)
-	if err != nil {
-		return "", err
+	if ctx.Err() == nil {
+		if err := downloadEpisodes(ctx, queue, summary); err != nil {
+			l.Fatalf("%v", err)
+		}
+	}
+	code := summary.exitCode()
+	sig := interrupted()
+	if sig != nil {
+		code = exitCode(sig)
+	}
+	summary.print(os.Stdout)
+	if *reportPath != "" {
+		if err := summary.writeJSON(*reportPath, code); err != nil {
+			l.Errorf("Failed to write the report - %v", err)
+		}
+	}
+	if sig != nil {
+		l.Warnf("Interrupted by %v, run the same command again to resume", sig)
 	}
-	s := doc.Find("#jeunesse-video-media").First()
-	val := s.Text()
+	os.Exit(code)
+}
 
-	var data RCCEpisodeJSON
-	if err = json.Unmarshal([]byte(val), &data); err != nil {
-		return "", err
+// exitListing exits a run which only listed the episodes, with an error
+// code when a source couldn't be listed or the run was interrupted.
+func exitListing(summary *runSummary, sig os.Signal) {
+	if sig != nil {
+		os.Exit(exitCode(sig))
 	}
+	os.Exit(summary.listingExitCode())
+}
+
+func usage() {
+	fmt.Fprintf(flag.CommandLine.Output(), `Usage:
+  %[1]s [flags] <show, episode or media url>...
+  %[1]s [flags] -batch-file <file or - for stdin>
+  %[1]s [flags] media [-app-code code] <idMedia>...
+  %[1]s [flags] retry [-max-attempts n]
+  %[1]s [flags] crawl [-delay d] [-catalogue file] [-download] <section url>
 
-	return rccMediaURL(data.IDMedia)
+Flags:
+`, os.Args[0])
+	flag.PrintDefaults()
 }
 
-func rccMediaURL(id string) (string, error) {
-	url := fmt.Sprintf("https://api.radio-canada.ca/validationMedia/v1/Validation.html?connectionType=broadband&output=json&multibitrate=true&deviceType=ipad&appCode=medianet&idMedia=%s", id)
-	res, err := http.Get(url)
+// listShow lists the show and its episodes available at the URL using the
+// matching provider.
+func listShow(ctx context.Context, rawURL string) (Provider, *Show, error) {
+	provider, showURL, err := providerFor(rawURL)
 	if err != nil {
-		return "", err
+		return nil, nil, err
 	}
-	defer res.Body.Close()
-	if res.StatusCode != 200 {
-		return "", fmt.Errorf("status code error: %d %s", res.StatusCode, res.Status)
-	}
-	var data RCCURLJSON
-	if err = json.NewDecoder(res.Body).Decode(&data); err != nil {
-		return "", err
+	l := loggerFrom(ctx).With("show", rawURL)
+	l.Debugf("Listing the episodes using the %s provider", provider.Name())
+	show, err := provider.ListShow(withLogger(ctx, l), showURL)
+	if err != nil {
+		return nil, nil, fmt.Errorf("something went wrong when fetching the URL - %v", err)
 	}
-	return data.URL, nil
+	l.Debugf("%d episodes listed in %d seasons", len(show.Episodes()), len(show.Seasons))
+	return provider, show, nil
 }
 
-func listRCCEpisodesFromURL(url string) ([]dlLink, error) {
-	res, err := http.Get(url)
+// mediaQueue parses the arguments of the media command and queues the
+// passed media.
+func mediaQueue(ctx context.Context, args []string, filter *episodeFilter, summary *runSummary) ([]queueItem, error) {
+	fs := flag.NewFlagSet("media", flag.ExitOnError)
+	appCode := fs.String("app-code", medianetAppCode, "application code of the media catalogue (medianet, gem...)")
+	fs.Parse(args)
+	if fs.NArg() < 1 {
+		return nil, fmt.Errorf("you need to pass at least one idMedia")
+	}
+	provider := &mediaProvider{}
+	episodes, err := provider.listMedia(ctx, fs.Args(), *appCode)
 	if err != nil {
 		return nil, err
 	}
-	defer res.Body.Close()
-	if res.StatusCode != 200 {
-		return nil, fmt.Errorf("status code error: %d %s", res.StatusCode, res.Status)
+	nameEpisodes(ctx, episodePointers(episodes))
+	var queue []queueItem
+	for _, i := range filter.apply(episodes) {
+		ep := episodes[i]
+		summary.listed(ep.IDMedia, 1)
+		queue = append(queue, queueItem{Source: ep.IDMedia, Position: i + 1, Provider: provider, Episode: ep})
 	}
+	return queue, nil
+}
 
-	// Load the HTML document
-	doc, err := goquery.NewDocumentFromReader(res.Body)
+// downloadEpisodes downloads the queued episodes one after the other, the
+// state is saved after each episode so the run can be resumed.
+func downloadEpisodes(ctx context.Context, queue []queueItem, summary *runSummary) error {
+	state, err := loadState(".")
 	if err != nil {
-		return nil, err
+		return fmt.Errorf("failed to read the resume state - %v", err)
 	}
 
-	links := []dlLink{}
-	var link string
-	// Find the review items
-	doc.Find(".medianet-content").Each(func(i int, s *goquery.Selection) {
-		// For each item found, get the band and title
-		link, _ = s.Attr("href")
-		if link[0] == '/' {
-			link = fmt.Sprintf("https://%s%s", res.Request.URL.Host, link)
+	l := loggerFrom(ctx)
+	p := newProgress(os.Stdout, len(queue))
+	l.setProgress(p)
+	defer l.setProgress(nil)
+	d := newDownloader(p)
+	for _, item := range queue {
+		if ctx.Err() != nil {
+			break
 		}
-		if len(link) > 0 {
-			title := strings.TrimSpace(s.ChildrenFiltered("div.vigette-content-info").ChildrenFiltered("h3.title").Text())
-			links = append(links, dlLink{Title: title, URL: link})
+		el := l.With("show", item.Source, "episode", item.Episode.Title, "idMedia", item.Episode.IDMedia)
+		status, err := downloadEpisode(withLogger(ctx, el), d, state, item)
+		if ctx.Err() != nil {
+			break
+		}
+		switch {
+		case status == statusUnavailable:
+			el.Warnf("%s is unavailable - %v", item.Episode.Title, err)
+		case err != nil:
+			el.Errorf("Failed to download %s - %v", item.Episode.Title, err)
+		}
+		summary.record(item.Source, reportEpisode(item.Episode, status), err)
+		p.FinishEpisode()
+		if err := state.save("."); err != nil {
+			l.Warnf("Failed to save the resume state - %v", err)
+		}
+		if isLowSpace(err) {
+			l.Errorf("Stopping, run the same command again once space is freed")
+			break
 		}
-	})
-	return links, nil
+	}
+	if err := state.save("."); err != nil {
+		l.Warnf("Failed to save the resume state - %v", err)
+	}
+	p.Close()
+	return nil
 }
 
-func toutTv(showName string) {
-	resp, err := query(presQuery(showName))
-	if err != nil {
-		log.Printf("Something went wrong connecting to the server: %v\n", err)
-		os.Exit(1)
+// downloadEpisode downloads and converts an episode. If the context is
+// canceled, the progress is recorded in the state so the episode can be
+// resumed. Failures are recorded in the state so they can be retried.
+func downloadEpisode(ctx context.Context, d *downloader, state *runState, item queueItem) (status episodeStatus, err error) {
+	l := loggerFrom(ctx)
+	provider, u := item.Provider, item.Episode
+	filename, mp4Path := episodePaths(u)
+	var mediaURL string
+	defer func() {
+		switch {
+		case status == statusDownloaded || status == statusSkipped:
+			state.forgetFailure(filename)
+		case status == statusFailed && ctx.Err() == nil && !isLowSpace(err):
+			state.recordFailure(item, filename, mediaURL, err)
+		}
+	}()
+	if fileExists(mp4Path) {
+		l.Infof("%s already downloaded", u.Title)
+		return statusSkipped, nil
 	}
-	defer resp.Body.Close()
-	if resp.StatusCode != 200 {
-		log.Printf("The server didn't respond with the expected status code, got: %d\n", resp.StatusCode)
-		body, _ := ioutil.ReadAll(resp.Body)
-		log.Println(string(body))
-		os.Exit(1)
+	if u.Unavailable {
+		return statusUnavailable, &unavailableError{"flagged as unavailable by the listing"}
+	}
+	js := state.interrupted(filename)
+	if js == nil {
+		js = &jobState{Title: u.Title, PageURL: u.URL, Filename: filename, DestPath: filepath.Dir(mp4Path)}
 	}
-	var data PresentationResponse
-	if err = json.NewDecoder(resp.Body).Decode(&data); err != nil {
-		log.Fatalf("Failed to parse the response data - %v", err)
-	}
-	for _, lineup := range data.SeasonLineups {
-		if lineup.Name == "single" {
-			for i, ep := range lineup.LineupItems {
-				id := ep.Key[6:]
-				fmt.Printf("%d - ID: %s - Title: %s (template: %s)\n", i,
-					id, ep.Title, ep.Template)
-				// pid := ep.IDMedia
-				if ep.Template == "media" {
 
-				}
+	tsPath := js.TsPath
+	if tsPath == "" || !fileExists(tsPath) {
+		var stream *MediaStream
+		stream, err = provider.ResolveMedia(ctx, u)
+		if isUnavailable(err) {
+			return statusUnavailable, err
+		}
+		if err != nil {
+			return statusFailed, err
+		}
+		mediaURL = stream.URL
+		l.Debugf("Resolved the media to %s for the %s device type", mediaURL, stream.DeviceType)
+		l.Infof("-> Downloading %s | %s", u.Title, u.URL)
+		job := &dlJob{URL: mediaURL, DestPath: js.DestPath, Filename: filename, Segments: js.Segments}
+		// the signed URL can expire during a long download
+		job.Resolve = func(ctx context.Context) (string, error) {
+			stream, err := provider.ResolveMedia(ctx, u)
+			if err != nil {
+				return "", err
 			}
-			break
+			mediaURL = stream.URL
+			return stream.URL, nil
+		}
+		tsPath, err = d.download(ctx, job)
+		if err != nil {
+			if ctx.Err() != nil || isLowSpace(err) {
+				js.TsPath = ""
+				js.Segments = job.Segments
+				js.Downloaded = int(job.Downloaded)
+				state.setInterrupted(js)
+			}
+			return statusFailed, err
 		}
 	}
 
-}
-
-func query(url string) (resp *http.Response, err error) {
-	req, err := http.NewRequest(http.MethodGet, url, nil)
-	if err != nil {
-		log.Fatal(err)
+	if fi, err := os.Stat(tsPath); err == nil {
+		// the mp4 is about the size of the ts
+		if err := waitForSpace(ctx, filepath.Dir(mp4Path), uint64(fi.Size())); err != nil {
+			js.TsPath = tsPath
+			state.setInterrupted(js)
+			return statusFailed, err
+		}
 	}
-	req.Header.Set("User-Agent", "Mozilla/5.0 (iPhone; U; CPU iPhone OS 5_0 like Mac OS X; en-us) AppleWebKit/532.9 (KHTML, like Gecko) Version/5.0.5 Mobile/8A293 Safari/6531.22.7")
-	req.Header.Set("Content-Type", "application/json")
-
-	return http.DefaultClient.Do(req)
+	if err := convertTsToMp4(ctx, Converter, tsPath, mp4Path); err != nil {
+		if ctx.Err() != nil {
+			js.TsPath = tsPath
+			state.setInterrupted(js)
+		}
+		return statusFailed, fmt.Errorf("failed to convert %s - %v", tsPath, err)
+	}
+	state.forget(filename)
+	l.Infof("Episode available at %s", mp4Path)
+	return statusDownloaded, nil
 }
 
-func presQuery(showKey string) string {
-	return fmt.Sprintf("%s%s?v=2&d=android&excludeLineups=0", presentationURL, showKey)
+// reportEpisode describes the outcome of the episode for the summary.
+func reportEpisode(u Episode, status episodeStatus) episodeReport {
+	r := episodeReport{Title: u.Title, URL: u.URL, Status: status, Rating: u.Rating, Tags: u.Tags}
+	if status == statusDownloaded || status == statusSkipped {
+		_, r.Path = episodePaths(u)
+	}
+	if status == statusDownloaded {
+		if fi, err := os.Stat(r.Path); err == nil {
+			r.Bytes = fi.Size()
+		}
+	}
+	return r
 }
 
-type RCCURLJSON struct {
-	URL       string      `json:"url"`
-	Message   interface{} `json:"message"`
-	ErrorCode int         `json:"errorCode"`
-	Params    []struct {
-		Name  string      `json:"name"`
-		Value interface{} `json:"value"`
-	} `json:"params"`
-	Bitrates []struct {
-		Bitrate int         `json:"bitrate"`
-		Width   int         `json:"width"`
-		Height  int         `json:"height"`
-		Lines   string      `json:"lines"`
-		Param   interface{} `json:"param"`
-	} `json:"bitrates"`
+// episodePaths returns the name used for the temporary files of the episode
+// and the path of the final mp4.
+func episodePaths(u Episode) (filename, mp4Path string) {
+	filename = filenames.episodeName(fileTitle(&u))
+	dir := "."
+	if u.Extra {
+		// the folder name media servers look the extras up in
+		dir = extrasDir
+	}
+	return filename, filepath.Join(dir, filename) + ".mp4"
 }
 
-// RCCEpisodeJSON is the JSON structure for the show information available in
-// the episode's page.
-type RCCEpisodeJSON struct {
-	AppCode string `json:"appCode"`
-	IDMedia string `json:"idMedia"`
-	Params  struct {
-		AutoPlay       bool   `json:"autoPlay"`
-		CanExtract     bool   `json:"canExtract"`
-		CanFullScreen  bool   `json:"canFullScreen"`
-		Gui            string `json:"gui"`
-		Height         string `json:"height"`
-		ID             string `json:"id"`
-		InfoBar        bool   `json:"infoBar"`
-		IsNextable     bool   `json:"isNextable"`
-		IsPreviousable bool   `json:"isPreviousable"`
-		Lang           string `json:"lang"`
-		Next           bool   `json:"next"`
-		Previous       bool   `json:"previous"`
-		Share          bool   `json:"share"`
-		Time           string `json:"time"`
-		URLTeaser      string `json:"urlTeaser"`
-		Width          string `json:"width"`
-	} `json:"params"`
+// fileTitle is the title the files of the episode are named after, such as
+// "S02E03 - Le retour" when its season and episode numbers are known.
+func fileTitle(ep *Episode) string {
+	if code := ep.code(); code != "" {
+		return code + " - " + ep.Title
+	}
+	return ep.Title
 }
 
-type PresentationResponse struct {
-	ExternalLinks []struct {
-		Title    string `json:"Title"`
-		Text     string `json:"Text"`
-		URL      string `json:"Url"`
-		ImageURL string `json:"ImageUrl"`
-		LogoName string `json:"LogoName"`
-		LogoURL  string `json:"LogoUrl"`
-	} `json:"ExternalLinks"`
-	ITunesLink               interface{} `json:"ITunesLink"`
-	CreditStartTimeInSeconds float64     `json:"CreditStartTimeInSeconds"`
-	LengthInSeconds          float64     `json:"LengthInSeconds"`
-	OtherLineups             []struct {
-		SelectedIndex interface{} `json:"SelectedIndex"`
-		Name          string      `json:"Name"`
-		Title         string      `json:"Title"`
-		HasURL        bool        `json:"HasUrl"`
-		URL           interface{} `json:"Url"`
-		Ratio         string      `json:"Ratio"`
-		Color         string      `json:"Color"`
-		LineupItems   []struct {
-			BookmarkKey      string      `json:"BookmarkKey"`
-			Key              string      `json:"Key"`
-			AppleKey         string      `json:"AppleKey"`
-			Template         string      `json:"Template"`
-			Title            string      `json:"Title"`
-			IsFree           bool        `json:"IsFree"`
-			IsDrm            bool        `json:"IsDrm"`
-			IsActive         bool        `json:"IsActive"`
-			Description      string      `json:"Description"`
-			PromoDescription interface{} `json:"PromoDescription"`
-			ImageURL         string      `json:"ImageUrl"`
-			URL              string      `json:"Url"`
-			TrackingURL      interface{} `json:"TrackingUrl"`
-			Details          struct {
-				Rating    interface{} `json:"Rating"`
-				Networks  interface{} `json:"Networks"`
-				Country   interface{} `json:"Country"`
-				AirDate   interface{} `json:"AirDate"`
-				Copyright interface{} `json:"Copyright"`
-				Persons   interface{} `json:"Persons"`
-				Tags      []struct {
-					Key   string `json:"Key"`
-					Value []struct {
-						ID                   int           `json:"Id"`
-						URL                  string        `json:"Url"`
-						Title                string        `json:"Title"`
-						TypeTag              string        `json:"TypeTag"`
-						UniversalSearchGenre string        `json:"UniversalSearchGenre"`
-						ChildTags            []interface{} `json:"ChildTags"`
-						ParentTag            interface{}   `json:"ParentTag"`
-					} `json:"Value"`
-				} `json:"Tags"`
-				Length         int         `json:"Length"`
-				Description    string      `json:"Description"`
-				DetailsTitle   string      `json:"DetailsTitle"`
-				ImageURL       string      `json:"ImageUrl"`
-				ProductionYear int         `json:"ProductionYear"`
-				LengthText     interface{} `json:"LengthText"`
-				OriginalTitle  interface{} `json:"OriginalTitle"`
-				Type           string      `json:"Type"`
-			} `json:"Details"`
-			Details2             interface{} `json:"Details2"`
-			DepartureDescription interface{} `json:"DepartureDescription"`
-			MigrationDescription interface{} `json:"MigrationDescription"`
-			ArrivalDescription   interface{} `json:"ArrivalDescription"`
-			Share                struct {
-				ShareTitle  string `json:"ShareTitle"`
-				URL         string `json:"Url"`
-				AbsoluteURL string `json:"AbsoluteUrl"`
-			} `json:"Share"`
-			Length           interface{} `json:"Length"`
-			FilterValueA     string      `json:"FilterValueA"`
-			IsGeolocalized   bool        `json:"IsGeolocalized"`
-			HasNewEpisodes   bool        `json:"HasNewEpisodes"`
-			ExcludeDevice    interface{} `json:"ExcludeDevice"`
-			LogoTargettingID interface{} `json:"LogoTargettingId"`
-		} `json:"LineupItems"`
-		HasLineupNavigation     bool          `json:"HasLineupNavigation"`
-		IsFree                  bool          `json:"IsFree"`
-		LineupNavigationItems   interface{}   `json:"LineupNavigationItems"`
-		Header                  interface{}   `json:"Header"`
-		FilterValueA            interface{}   `json:"FilterValueA"`
-		FilterValueB            interface{}   `json:"FilterValueB"`
-		LineupItemFiltersA      []interface{} `json:"LineupItemFiltersA"`
-		ActiveLineupItemFilterA interface{}   `json:"ActiveLineupItemFilterA"`
-		Behaviour               string        `json:"Behaviour"`
-		LineupItemTextTemplate  string        `json:"LineupItemTextTemplate"`
-		Theme                   interface{}   `json:"Theme"`
-	} `json:"OtherLineups"`
-	SelectedSeasonName string `json:"SelectedSeasonName"`
-	SeasonLineups      []struct {
-		SelectedIndex int         `json:"SelectedIndex"`
-		Name          string      `json:"Name"`
-		Title         string      `json:"Title"`
-		HasURL        bool        `json:"HasUrl"`
-		URL           interface{} `json:"Url"`
-		Ratio         string      `json:"Ratio"`
-		Color         string      `json:"Color"`
-		LineupItems   []struct {
-			IDMedia          string      `json:"IdMedia"`
-			AppCode          string      `json:"AppCode"`
-			CapsuleType      interface{} `json:"CapsuleType"`
-			IsNew            bool        `json:"IsNew"`
-			NoFMC            interface{} `json:"NoFMC"`
-			IsAvailable      bool        `json:"IsAvailable"`
-			BookmarkKey      string      `json:"BookmarkKey"`
-			Key              string      `json:"Key"`
-			AppleKey         string      `json:"AppleKey"`
-			Template         string      `json:"Template"`
-			Title            string      `json:"Title"`
-			IsFree           bool        `json:"IsFree"`
-			IsDrm            bool        `json:"IsDrm"`
-			IsActive         bool        `json:"IsActive"`
-			Description      string      `json:"Description"`
-			PromoDescription interface{} `json:"PromoDescription"`
-			ImageURL         string      `json:"ImageUrl"`
-			URL              string      `json:"Url"`
-			TrackingURL      interface{} `json:"TrackingUrl"`
-			Details          struct {
-				Rating    string        `json:"Rating"`
-				Networks  interface{}   `json:"Networks"`
-				Country   interface{}   `json:"Country"`
-				AirDate   string        `json:"AirDate"`
-				Copyright string        `json:"Copyright"`
-				Persons   []interface{} `json:"Persons"`
-				Tags      []struct {
-					Key   string `json:"Key"`
-					Value []struct {
-						ID                   int           `json:"Id"`
-						URL                  string        `json:"Url"`
-						Title                string        `json:"Title"`
-						TypeTag              string        `json:"TypeTag"`
-						UniversalSearchGenre string        `json:"UniversalSearchGenre"`
-						ChildTags            []interface{} `json:"ChildTags"`
-						ParentTag            interface{}   `json:"ParentTag"`
-					} `json:"Value"`
-				} `json:"Tags"`
-				Length         int    `json:"Length"`
-				Description    string `json:"Description"`
-				DetailsTitle   string `json:"DetailsTitle"`
-				ImageURL       string `json:"ImageUrl"`
-				ProductionYear int    `json:"ProductionYear"`
-				LengthText     string `json:"LengthText"`
-				OriginalTitle  string `json:"OriginalTitle"`
-				Type           string `json:"Type"`
-			} `json:"Details"`
-			Details2             interface{} `json:"Details2"`
-			DepartureDescription interface{} `json:"DepartureDescription"`
-			MigrationDescription interface{} `json:"MigrationDescription"`
-			ArrivalDescription   interface{} `json:"ArrivalDescription"`
-			Share                struct {
-				ShareTitle  string `json:"ShareTitle"`
-				URL         string `json:"Url"`
-				AbsoluteURL string `json:"AbsoluteUrl"`
-			} `json:"Share"`
-			Length           interface{} `json:"Length"`
-			FilterValueA     interface{} `json:"FilterValueA"`
-			IsGeolocalized   bool        `json:"IsGeolocalized"`
-			HasNewEpisodes   bool        `json:"HasNewEpisodes"`
-			ExcludeDevice    string      `json:"ExcludeDevice"`
-			LogoTargettingID interface{} `json:"LogoTargettingId"`
-		} `json:"LineupItems"`
-		HasLineupNavigation     bool          `json:"HasLineupNavigation"`
-		IsFree                  bool          `json:"IsFree"`
-		LineupNavigationItems   interface{}   `json:"LineupNavigationItems"`
-		Header                  interface{}   `json:"Header"`
-		FilterValueA            interface{}   `json:"FilterValueA"`
-		FilterValueB            interface{}   `json:"FilterValueB"`
-		LineupItemFiltersA      []interface{} `json:"LineupItemFiltersA"`
-		ActiveLineupItemFilterA interface{}   `json:"ActiveLineupItemFilterA"`
-		Behaviour               string        `json:"Behaviour"`
-		LineupItemTextTemplate  interface{}   `json:"LineupItemTextTemplate"`
-		Theme                   interface{}   `json:"Theme"`
-	} `json:"SeasonLineups"`
-	SeasonLineupsTitle interface{} `json:"SeasonLineupsTitle"`
-	HasPlayButton      bool        `json:"HasPlayButton"`
-	PlayButtonText     string      `json:"PlayButtonText"`
-	PlayButtonText2    string      `json:"PlayButtonText2"`
-	StatsMetas         struct {
-		Description                     string `json:"description"`
-		RcDomaine                       string `json:"rc.domaine"`
-		RcApplication                   string `json:"rc.application"`
-		RcFormatapplication             string `json:"rc.formatapplication"`
-		RcSection                       string `json:"rc.section"`
-		RcGroupesection                 string `json:"rc.groupesection"`
-		RcListe                         string `json:"rc.liste"`
-		RcSegment                       string `json:"rc.segment"`
-		RcPagesegment                   string `json:"rc.pagesegment"`
-		RcCodepage                      string `json:"rc.codepage"`
-		RcNiveau                        string `json:"rc.niveau"`
-		RcEmission                      string `json:"rc.emission"`
-		RcCodeemission                  string `json:"rc.codeemission"`
-		RcTitre                         string `json:"rc.titre"`
-		RcSaison                        string `json:"rc.saison"`
-		RcEpisode                       string `json:"rc.episode"`
-		RcCollection                    string `json:"rc.collection"`
-		RcGenre                         string `json:"rc.genre"`
-		RcVientdemaliste                string `json:"rc.vientdemaliste"`
-		RcAcces                         string `json:"rc.acces"`
-		RcTelco                         string `json:"rc.telco"`
-		RcPlan                          string `json:"rc.plan"`
-		RcForfait                       string `json:"rc.forfait"`
-		RcIdcampagne                    string `json:"rc.idcampagne"`
-		AppleMediaServiceSubscriptionV2 string `json:"apple-media-service-subscription-v2"`
-		Keywords                        string `json:"keywords"`
-		RcExtra                         string `json:"rc.extra"`
-		FbAppID                         string `json:"fb:app_id"`
-		OgTitle                         string `json:"og:title"`
-		OgDescription                   string `json:"og:description"`
-		OgURL                           string `json:"og:url"`
-		OgType                          string `json:"og:type"`
-		OgImage                         string `json:"og:image"`
-	} `json:"StatsMetas"`
-	MediaURL                   string      `json:"MediaUrl"`
-	MediaTitle                 string      `json:"MediaTitle"`
-	BackgroundImageURL         interface{} `json:"BackgroundImageUrl"`
-	IsPubMandatoryForAllUsers  bool        `json:"IsPubMandatoryForAllUsers"`
-	IsPubMandatoryForFreeUsers bool        `json:"IsPubMandatoryForFreeUsers"`
-	ShowPub                    bool        `json:"ShowPub"`
-	IDMedia                    string      `json:"IdMedia"`
-	AppCode                    string      `json:"AppCode"`
-	CapsuleType                interface{} `json:"CapsuleType"`
-	IsNew                      bool        `json:"IsNew"`
-	NoFMC                      interface{} `json:"NoFMC"`
-	IsAvailable                bool        `json:"IsAvailable"`
-	BookmarkKey                string      `json:"BookmarkKey"`
-	Key                        string      `json:"Key"`
-	AppleKey                   string      `json:"AppleKey"`
-	Template                   string      `json:"Template"`
-	Title                      string      `json:"Title"`
-	IsFree                     bool        `json:"IsFree"`
-	IsDrm                      bool        `json:"IsDrm"`
-	IsActive                   bool        `json:"IsActive"`
-	Description                string      `json:"Description"`
-	PromoDescription           interface{} `json:"PromoDescription"`
-	ImageURL                   string      `json:"ImageUrl"`
-	URL                        interface{} `json:"Url"`
-	TrackingURL                interface{} `json:"TrackingUrl"`
-	Details                    struct {
-		Rating    interface{} `json:"Rating"`
-		Networks  interface{} `json:"Networks"`
-		Country   interface{} `json:"Country"`
-		AirDate   interface{} `json:"AirDate"`
-		Copyright interface{} `json:"Copyright"`
-		Persons   interface{} `json:"Persons"`
-		Tags      []struct {
-			Key   string `json:"Key"`
-			Value []struct {
-				ID                   int           `json:"Id"`
-				URL                  string        `json:"Url"`
-				Title                string        `json:"Title"`
-				TypeTag              string        `json:"TypeTag"`
-				UniversalSearchGenre string        `json:"UniversalSearchGenre"`
-				ChildTags            []interface{} `json:"ChildTags"`
-				ParentTag            interface{}   `json:"ParentTag"`
-			} `json:"Value"`
-		} `json:"Tags"`
-		Length         int         `json:"Length"`
-		Description    string      `json:"Description"`
-		DetailsTitle   string      `json:"DetailsTitle"`
-		ImageURL       string      `json:"ImageUrl"`
-		ProductionYear int         `json:"ProductionYear"`
-		LengthText     interface{} `json:"LengthText"`
-		OriginalTitle  interface{} `json:"OriginalTitle"`
-		Type           string      `json:"Type"`
-	} `json:"Details"`
-	Details2             interface{} `json:"Details2"`
-	DepartureDescription interface{} `json:"DepartureDescription"`
-	MigrationDescription interface{} `json:"MigrationDescription"`
-	ArrivalDescription   interface{} `json:"ArrivalDescription"`
-	Share                struct {
-		ShareTitle  string `json:"ShareTitle"`
-		URL         string `json:"Url"`
-		AbsoluteURL string `json:"AbsoluteUrl"`
-	} `json:"Share"`
-	Length           interface{} `json:"Length"`
-	FilterValueA     string      `json:"FilterValueA"`
-	IsGeolocalized   bool        `json:"IsGeolocalized"`
-	HasNewEpisodes   bool        `json:"HasNewEpisodes"`
-	ExcludeDevice    interface{} `json:"ExcludeDevice"`
-	LogoTargettingID interface{} `json:"LogoTargettingId"`
+// httpGet issues a GET request canceled with the context, after the pause
+// required by the pacer of the context.
+func httpGet(ctx context.Context, client *http.Client, url string) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	if err := pacerFrom(ctx).wait(ctx); err != nil {
+		return nil, err
+	}
+	loggerFrom(ctx).Tracef("GET %s", url)
+	return client.Do(req.WithContext(ctx))
 }
 
 func fileExists(path string) bool {
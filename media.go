@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"strings"
+)
+
+// mediaProvider downloads media directly from their ids, used when the id is
+// already known and there is no page to scrape.
+type mediaProvider struct{}
+
+func (p *mediaProvider) Name() string {
+	return "radio-canada-media"
+}
+
+// Match always returns false, media are passed by id, not by URL.
+func (p *mediaProvider) Match(u *url.URL) bool {
+	return false
+}
+
+func (p *mediaProvider) ListShow(ctx context.Context, u *url.URL) (*Show, error) {
+	return nil, errors.New("media are listed by id, see listMedia")
+}
+
+// listMedia returns the media with the passed ids. The titles come from the
+// media metadata and fall back to the id.
+func (p *mediaProvider) listMedia(ctx context.Context, ids []string, appCode string) ([]Episode, error) {
+	links := []Episode{}
+	for _, id := range ids {
+		ep := Episode{IDMedia: strings.TrimSpace(id), AppCode: appCode}
+		md, err := p.Metadata(ctx, ep)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			md = &Episode{}
+		}
+		ep.Title, ep.Description, ep.ImageURL = md.Title, md.Description, md.ImageURL
+		if ep.Title == "" {
+			ep.Title = "media-" + ep.IDMedia
+		}
+		links = append(links, ep)
+	}
+	return links, nil
+}
+
+// Metadata queries the media metadata service, the validation service is
+// used as a fallback to find a title.
+func (p *mediaProvider) Metadata(ctx context.Context, ep Episode) (*Episode, error) {
+	md := &Episode{IDMedia: ep.IDMedia, AppCode: ep.AppCode}
+	metas, err := rccMediaMetadata(ctx, ep.IDMedia, ep.AppCode)
+	if err == nil {
+		md.Title = strings.TrimSpace(metas["Title"])
+		md.Description = metas["Description"]
+		md.ImageURL = metas["imageHR"]
+	}
+	if md.Title == "" {
+		if title, verr := rccMediaTitle(ctx, ep.IDMedia, ep.AppCode); verr == nil {
+			md.Title = title
+			err = nil
+		}
+	}
+	return md, err
+}
+
+func (p *mediaProvider) ResolveMedia(ctx context.Context, ep Episode) (*MediaStream, error) {
+	return rccMediaStream(ctx, ep.IDMedia, validationParams{AppCode: ep.AppCode})
+}
@@ -1 +1,127 @@
 package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// Show is a show as listed by a provider, every source maps its listing to
+// it so the episodes are handled the same whatever their origin.
+type Show struct {
+	// ID identifies the show for its provider, for instance its slug.
+	ID          string
+	Title       string
+	URL         string
+	Description string
+	ImageURL    string
+	Seasons     []*Season
+	// Extras are the videos which aren't episodes, such as clips, making-of
+	// and trailers.
+	Extras []Episode
+}
+
+// Season groups the episodes of a show, the shows without seasons have a
+// single season numbered 0.
+type Season struct {
+	Number   int
+	Title    string
+	Episodes []Episode
+}
+
+// Episode is an episode, or another video, of a show.
+type Episode struct {
+	Title string
+	// URL is the page of the episode.
+	URL string
+	// ID identifies the episode for its provider when the listing provides
+	// it, for instance the number in the URL of a jeunesse episode.
+	ID string
+	// IDMedia and AppCode identify the media when the listing provides
+	// them, saving a lookup of the episode's page.
+	IDMedia string
+	AppCode string
+	// SeasonNumber and EpisodeNumber are 0 when unknown.
+	SeasonNumber  int
+	EpisodeNumber int
+	Description   string
+	ImageURL      string
+	// Rating is the parental rating of the episode, empty when unknown.
+	Rating string
+	// Tags are the genres and themes of the episode.
+	Tags []Tag
+	// AirDate is the zero time when the listing doesn't provide it.
+	AirDate time.Time
+	// Duration is zero when the listing doesn't provide it.
+	Duration time.Duration
+	// Paid and Unavailable are set when the listing flags the episode as
+	// requiring a subscription or not available for download.
+	Paid        bool
+	Unavailable bool
+	// Extra is set for the videos which aren't episodes, they are saved in
+	// the Extras folder. Trailer is set for the extras which are trailers.
+	Extra   bool
+	Trailer bool
+}
+
+// Tag is a genre, theme or other tag of an episode, it is kept in the
+// reports and catalogues so the archive can be browsed by tag.
+type Tag struct {
+	// Type is the kind of tag, such as genre.
+	Type  string `json:"type,omitempty"`
+	Title string `json:"title"`
+	URL   string `json:"url,omitempty"`
+}
+
+// MediaStream is the HLS stream of a media, as returned by the validation
+// service.
+type MediaStream struct {
+	IDMedia string
+	AppCode string
+	// DeviceType is the device profile the stream was resolved for, it
+	// changes the formats and resolutions of the renditions.
+	DeviceType string
+	// URL is the playlist of the stream, it is signed and expires.
+	URL string
+}
+
+// code returns the season and episode numbers of the episode, such as S02E03,
+// or an empty string when they aren't both known.
+func (ep *Episode) code() string {
+	if ep.SeasonNumber <= 0 || ep.EpisodeNumber <= 0 {
+		return ""
+	}
+	return fmt.Sprintf("S%02dE%02d", ep.SeasonNumber, ep.EpisodeNumber)
+}
+
+// season returns the season with the passed number, adding it to the show
+// when needed.
+func (s *Show) season(number int) *Season {
+	for _, season := range s.Seasons {
+		if season.Number == number {
+			return season
+		}
+	}
+	season := &Season{Number: number}
+	s.Seasons = append(s.Seasons, season)
+	return season
+}
+
+// add adds the episode to its season, or to the extras.
+func (s *Show) add(ep Episode) {
+	if ep.Extra {
+		s.Extras = append(s.Extras, ep)
+		return
+	}
+	season := s.season(ep.SeasonNumber)
+	season.Episodes = append(season.Episodes, ep)
+}
+
+// Episodes returns the episodes of all the seasons, in order, followed by
+// the extras.
+func (s *Show) Episodes() []Episode {
+	episodes := []Episode{}
+	for _, season := range s.Seasons {
+		episodes = append(episodes, season.Episodes...)
+	}
+	return append(episodes, s.Extras...)
+}
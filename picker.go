@@ -0,0 +1,224 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// pickerRows is the number of episodes displayed at once by the picker.
+const pickerRows = 15
+
+var errPickerCanceled = errors.New("episode selection canceled")
+
+// pickEpisodes lets the user choose the episodes to download among the
+// queued ones. On a terminal the list is navigated with the arrow keys (or
+// j/k), space toggles an episode, a toggles all of them and enter confirms.
+// Otherwise the positions are read from a prompt.
+func pickEpisodes(in, out *os.File, queue []queueItem) ([]queueItem, error) {
+	if len(queue) == 0 {
+		return queue, nil
+	}
+	if isTerminal(in) && isTerminal(out) {
+		if restore, err := makeRaw(in.Fd()); err == nil {
+			defer restore()
+			return newPicker(queue).run(in, out)
+		}
+	}
+	return promptEpisodes(in, out, queue)
+}
+
+// promptEpisodes prints the queue and reads the positions of the episodes to
+// download, for instance 1-5,8.
+func promptEpisodes(in io.Reader, out io.Writer, queue []queueItem) ([]queueItem, error) {
+	for i, item := range queue {
+		fmt.Fprintf(out, "%3d. %s\n", i+1, episodeLine(item.Episode))
+	}
+	fmt.Fprint(out, "Episodes to download (for instance 1-5,8, empty for all): ")
+	line, err := bufio.NewReader(in).ReadString('\n')
+	if err != nil && (err != io.EOF || line == "") {
+		return nil, errPickerCanceled
+	}
+	line = strings.TrimSpace(line)
+	if line == "" {
+		return queue, nil
+	}
+	ranges, err := parseIndexRanges(line)
+	if err != nil {
+		return nil, err
+	}
+	var picked []queueItem
+	for i, item := range queue {
+		for _, r := range ranges {
+			if i+1 >= r.from && (r.to < 0 || i+1 <= r.to) {
+				picked = append(picked, item)
+				break
+			}
+		}
+	}
+	return picked, nil
+}
+
+// picker is the state of the interactive episode list.
+type picker struct {
+	queue    []queueItem
+	selected []bool
+	cursor   int
+	offset   int
+	drawn    int
+}
+
+func newPicker(queue []queueItem) *picker {
+	return &picker{queue: queue, selected: make([]bool, len(queue))}
+}
+
+func (p *picker) run(in io.Reader, out io.Writer) ([]queueItem, error) {
+	buf := make([]byte, 8)
+	for {
+		p.draw(out)
+		n, err := in.Read(buf)
+		if err != nil {
+			p.clear(out)
+			return nil, errPickerCanceled
+		}
+		switch key := string(buf[:n]); key {
+		case "\x1b[A", "k":
+			p.move(-1)
+		case "\x1b[B", "j":
+			p.move(1)
+		case "\x1b[5~":
+			p.move(-pickerRows)
+		case "\x1b[6~":
+			p.move(pickerRows)
+		case " ":
+			p.selected[p.cursor] = !p.selected[p.cursor]
+			p.move(1)
+		case "a":
+			all := true
+			for _, s := range p.selected {
+				all = all && s
+			}
+			for i := range p.selected {
+				p.selected[i] = !all
+			}
+		case "\r", "\n":
+			p.clear(out)
+			var picked []queueItem
+			for i, item := range p.queue {
+				if p.selected[i] {
+					picked = append(picked, item)
+				}
+			}
+			return picked, nil
+		case "q", "\x1b", "\x03":
+			p.clear(out)
+			return nil, errPickerCanceled
+		}
+	}
+}
+
+func (p *picker) move(delta int) {
+	p.cursor += delta
+	if p.cursor < 0 {
+		p.cursor = 0
+	}
+	if p.cursor >= len(p.queue) {
+		p.cursor = len(p.queue) - 1
+	}
+	if p.cursor < p.offset {
+		p.offset = p.cursor
+	}
+	if p.cursor >= p.offset+pickerRows {
+		p.offset = p.cursor - pickerRows + 1
+	}
+}
+
+// draw redraws the visible part of the list in place. The terminal is in raw
+// mode so lines end with \r\n.
+func (p *picker) draw(out io.Writer) {
+	var b strings.Builder
+	if p.drawn > 0 {
+		fmt.Fprintf(&b, "\x1b[%dA", p.drawn)
+	}
+	b.WriteString("\r\x1b[J")
+	count := 0
+	for _, s := range p.selected {
+		if s {
+			count++
+		}
+	}
+	fmt.Fprintf(&b, "%d/%d selected - up/down to move, space to select, a for all, enter to download, q to quit\r\n", count, len(p.queue))
+	p.drawn = 1
+	source := ""
+	if p.offset > 0 {
+		source = p.queue[p.offset-1].Source
+	}
+	for i := p.offset; i < len(p.queue) && i < p.offset+pickerRows; i++ {
+		item := p.queue[i]
+		cursor, check := " ", " "
+		if i == p.cursor {
+			cursor = ">"
+		}
+		if p.selected[i] {
+			check = "x"
+		}
+		line := fmt.Sprintf("%s [%s] %3d. %s", cursor, check, item.Position, episodeLine(item.Episode))
+		if item.Source != source {
+			source = item.Source
+			line += "  (" + source + ")"
+		}
+		b.WriteString(line + "\r\n")
+		p.drawn++
+	}
+	io.WriteString(out, b.String())
+}
+
+func (p *picker) clear(out io.Writer) {
+	if p.drawn > 0 {
+		fmt.Fprintf(out, "\x1b[%dA\r\x1b[J", p.drawn)
+		p.drawn = 0
+	}
+}
+
+// episodeLine describes an episode on a single line: air date, duration,
+// title and availability.
+func episodeLine(ep Episode) string {
+	date := "          "
+	if !ep.AirDate.IsZero() {
+		date = ep.AirDate.Format("2006-01-02")
+	}
+	duration := "     "
+	if ep.Duration > 0 {
+		duration = fmt.Sprintf("%5s", formatDuration(ep.Duration))
+	}
+	line := fmt.Sprintf("%s %s  %s", date, duration, ep.Title)
+	if code := ep.code(); code != "" {
+		line = fmt.Sprintf("%s %s  %s %s", date, duration, code, ep.Title)
+	}
+	switch {
+	case ep.Trailer:
+		line += " [trailer]"
+	case ep.Extra:
+		line += " [extra]"
+	}
+	switch {
+	case ep.Unavailable:
+		line += " [unavailable]"
+	case ep.Paid:
+		line += " [subscription]"
+	}
+	return line
+}
+
+// formatDuration formats d as h:mm:ss or m:ss.
+func formatDuration(d time.Duration) string {
+	s := int(d.Round(time.Second) / time.Second)
+	if s >= 3600 {
+		return fmt.Sprintf("%d:%02d:%02d", s/3600, s/60%60, s%60)
+	}
+	return fmt.Sprintf("%d:%02d", s/60, s%60)
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// episodePlan is what downloading an episode would do.
+type episodePlan struct {
+	item     queueItem
+	mp4Path  string
+	archived bool
+	pl       *playlist
+	err      error
+}
+
+// planDownloads resolves the queued episodes and reads their media playlists
+// without downloading any segment, printing what a run would do.
+func planDownloads(ctx context.Context, w io.Writer, queue []queueItem) {
+	client := &http.Client{}
+	var (
+		planned, archived, failed int
+		duration                  time.Duration
+		size                      int64
+		unknownSize               bool
+	)
+	for _, item := range queue {
+		if ctx.Err() != nil {
+			break
+		}
+		ep := planEpisode(ctx, client, item)
+		printPlan(w, ep)
+		switch {
+		case ep.archived:
+			archived++
+		case ep.err != nil:
+			failed++
+		default:
+			planned++
+			duration += ep.pl.duration()
+			if s := ep.pl.estimatedSize(); s > 0 {
+				size += s
+			} else {
+				unknownSize = true
+			}
+		}
+	}
+	estimate := "~" + formatBytes(size)
+	if unknownSize {
+		estimate += " (some sizes unknown)"
+	}
+	fmt.Fprintf(w, "Plan: %d to download (%s, %s), %d already archived, %d failed to resolve\n",
+		planned, formatDuration(duration), estimate, archived, failed)
+}
+
+func planEpisode(ctx context.Context, client *http.Client, item queueItem) *episodePlan {
+	_, mp4Path := episodePaths(item.Episode)
+	ep := &episodePlan{item: item, mp4Path: mp4Path}
+	if fileExists(mp4Path) {
+		ep.archived = true
+		return ep
+	}
+	stream, err := item.Provider.ResolveMedia(ctx, item.Episode)
+	if err != nil {
+		ep.err = err
+		return ep
+	}
+	if ep.pl, ep.err = fetchPlaylist(ctx, client, stream.URL); ep.err == nil && len(ep.pl.Segments) == 0 {
+		ep.err = fmt.Errorf("no segments found in %s", ep.pl.URL)
+	}
+	return ep
+}
+
+func printPlan(w io.Writer, ep *episodePlan) {
+	fmt.Fprintf(w, "%s\n  -> %s\n", ep.item.Episode.Title, ep.mp4Path)
+	switch {
+	case ep.archived:
+		fmt.Fprintln(w, "  already archived, would be skipped")
+	case ep.err != nil:
+		fmt.Fprintf(w, "  failed to resolve - %v\n", ep.err)
+	default:
+		rendition := "single rendition"
+		if r := ep.pl.Rendition; r != nil {
+			rendition = fmt.Sprintf("%s %d kbps", r.Resolution, r.Bandwidth/1000)
+		}
+		size := "unknown size"
+		if s := ep.pl.estimatedSize(); s > 0 {
+			size = "~" + formatBytes(s)
+		}
+		fmt.Fprintf(w, "  %s, %d segments, %s, %s\n", rendition, len(ep.pl.Segments), formatDuration(ep.pl.duration()), size)
+	}
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mattetti/m3u8Grabber/m3u8"
+)
+
+// playlist is a HLS media playlist.
+type playlist struct {
+	URL string
+	// Rendition is the variant picked when the URL pointed to a master
+	// playlist.
+	Rendition *m3u8.Rendition
+	Segments  []segment
+}
+
+type segment struct {
+	URL      string
+	Duration float64
+	// Sequence is the media sequence number of the segment, used as the IV
+	// when the key doesn't specify one.
+	Sequence int
+	Key      *segmentKey
+}
+
+// duration is the sum of the segment durations.
+func (pl *playlist) duration() time.Duration {
+	var d float64
+	for _, seg := range pl.Segments {
+		d += seg.Duration
+	}
+	return time.Duration(d * float64(time.Second))
+}
+
+// estimatedSize estimates the size of the stream from the bandwidth of the
+// rendition, 0 when the bandwidth is unknown.
+func (pl *playlist) estimatedSize() int64 {
+	if pl.Rendition == nil || pl.Rendition.Bandwidth <= 0 {
+		return 0
+	}
+	return int64(pl.duration().Seconds() * float64(pl.Rendition.Bandwidth) / 8)
+}
+
+// segmentKey describes the encryption of a segment, see EXT-X-KEY.
+type segmentKey struct {
+	Method string
+	URI    string
+	IV     []byte
+}
+
+// fetchPlaylist downloads and parses the playlist at u. When u is a master
+// playlist, the rendition with the highest bandwidth is downloaded.
+func fetchPlaylist(ctx context.Context, client *http.Client, u string) (*playlist, error) {
+	lines, err := fetchPlaylistLines(ctx, client, u)
+	if err != nil {
+		return nil, err
+	}
+	base, err := url.Parse(u)
+	if err != nil {
+		return nil, err
+	}
+
+	var renditions []m3u8.Rendition
+	for i := 0; i < len(lines); i++ {
+		if strings.HasPrefix(lines[i], "#EXT-X-STREAM-INF") && i+1 < len(lines) {
+			r := m3u8.ExtractRendition(lines[i])
+			i++
+			r.URL = resolveURL(base, lines[i])
+			renditions = append(renditions, r)
+		}
+	}
+	if len(renditions) > 0 {
+		sort.Slice(renditions, func(i, j int) bool {
+			return renditions[i].Bandwidth > renditions[j].Bandwidth
+		})
+		pl, err := fetchPlaylist(ctx, client, renditions[0].URL)
+		if err != nil {
+			return nil, err
+		}
+		pl.Rendition = &renditions[0]
+		return pl, nil
+	}
+
+	pl := &playlist{URL: u}
+	var key *segmentKey
+	var duration float64
+	sequence := 0
+	for _, l := range lines {
+		switch {
+		case strings.HasPrefix(l, "#EXT-X-MEDIA-SEQUENCE:"):
+			sequence, _ = strconv.Atoi(l[len("#EXT-X-MEDIA-SEQUENCE:"):])
+		case strings.HasPrefix(l, "#EXT-X-KEY:"):
+			key, err = parseKey(base, l[len("#EXT-X-KEY:"):])
+			if err != nil {
+				return nil, err
+			}
+		case strings.HasPrefix(l, "#EXTINF:"):
+			d := l[len("#EXTINF:"):]
+			if idx := strings.IndexByte(d, ','); idx >= 0 {
+				d = d[:idx]
+			}
+			duration, _ = strconv.ParseFloat(d, 64)
+		case l != "" && !strings.HasPrefix(l, "#"):
+			pl.Segments = append(pl.Segments, segment{
+				URL:      resolveURL(base, l),
+				Duration: duration,
+				Sequence: sequence,
+				Key:      key,
+			})
+			sequence++
+			duration = 0
+		}
+	}
+	return pl, nil
+}
+
+func fetchPlaylistLines(ctx context.Context, client *http.Client, u string) ([]string, error) {
+	res, err := httpGet(ctx, client, u)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != 200 {
+		return nil, fmt.Errorf("status code error: %d %s", res.StatusCode, res.Status)
+	}
+	var lines []string
+	scanner := bufio.NewScanner(res.Body)
+	for scanner.Scan() {
+		lines = append(lines, strings.TrimSpace(scanner.Text()))
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(lines) == 0 || lines[0] != "#EXTM3U" {
+		return nil, fmt.Errorf("%s is not a valid m3u8 file", u)
+	}
+	return lines, nil
+}
+
+// parseKey parses the attributes of a EXT-X-KEY tag.
+func parseKey(base *url.URL, attrs string) (*segmentKey, error) {
+	key := &segmentKey{}
+	for _, attr := range splitAttributes(attrs) {
+		idx := strings.IndexByte(attr, '=')
+		if idx < 0 {
+			continue
+		}
+		name, value := attr[:idx], strings.Trim(attr[idx+1:], `"`)
+		switch name {
+		case "METHOD":
+			key.Method = value
+		case "URI":
+			key.URI = resolveURL(base, value)
+		case "IV":
+			iv, err := hex.DecodeString(strings.TrimPrefix(strings.TrimPrefix(value, "0x"), "0X"))
+			if err != nil {
+				return nil, fmt.Errorf("invalid key IV %s - %v", value, err)
+			}
+			key.IV = iv
+		}
+	}
+	switch key.Method {
+	case "NONE":
+		return nil, nil
+	case "AES-128":
+		return key, nil
+	}
+	return nil, fmt.Errorf("unsupported encryption method %s", key.Method)
+}
+
+// splitAttributes splits a comma separated attribute list, ignoring the
+// commas in quoted strings.
+func splitAttributes(s string) []string {
+	var attrs []string
+	quoted := false
+	start := 0
+	for i, c := range s {
+		switch c {
+		case '"':
+			quoted = !quoted
+		case ',':
+			if !quoted {
+				attrs = append(attrs, strings.TrimSpace(s[start:i]))
+				start = i + 1
+			}
+		}
+	}
+	return append(attrs, strings.TrimSpace(s[start:]))
+}
+
+func resolveURL(base *url.URL, ref string) string {
+	u, err := url.Parse(ref)
+	if err != nil {
+		return ref
+	}
+	return base.ResolveReference(u).String()
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// playlistServer serves the passed files, keyed by path.
+func playlistServer(files map[string]string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, ok := files[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(body))
+	}))
+}
+
+func TestFetchPlaylist(t *testing.T) {
+	srv := playlistServer(map[string]string{
+		"/master.m3u8": `#EXTM3U
+#EXT-X-STREAM-INF:PROGRAM-ID=1,BANDWIDTH=800000,RESOLUTION=640x360,CODECS="avc1.4d401e,mp4a.40.2"
+low/index.m3u8
+#EXT-X-STREAM-INF:PROGRAM-ID=1,BANDWIDTH=2500000,RESOLUTION=1280x720,CODECS="avc1.4d401f,mp4a.40.2"
+high/index.m3u8
+#EXT-X-STREAM-INF:PROGRAM-ID=1,BANDWIDTH=1200000,RESOLUTION=960x540,CODECS="avc1.4d401f,mp4a.40.2"
+mid/index.m3u8
+`,
+		"/high/index.m3u8": `#EXTM3U
+#EXT-X-TARGETDURATION:10
+#EXT-X-MEDIA-SEQUENCE:7
+#EXTINF:10.000,
+seg7.ts
+#EXT-X-KEY:METHOD=AES-128,URI="/keys/k1",IV=0x000102030405060708090A0B0C0D0E0F
+#EXTINF:9.5,title
+seg8.ts
+#EXT-X-KEY:METHOD=AES-128,URI="k2"
+#EXTINF:4,
+https://cdn.example.com/seg9.ts
+#EXT-X-KEY:METHOD=NONE
+#EXTINF:2.5,
+seg10.ts
+#EXT-X-ENDLIST
+`,
+		"/aes.m3u8": `#EXTM3U
+#EXT-X-KEY:METHOD=SAMPLE-AES,URI="k"
+#EXTINF:10,
+seg.ts
+`,
+		"/bad-iv.m3u8": `#EXTM3U
+#EXT-X-KEY:METHOD=AES-128,URI="k",IV=0xZZ
+#EXTINF:10,
+seg.ts
+`,
+		"/text.m3u8": "<html></html>",
+	})
+	defer srv.Close()
+	ctx := context.Background()
+
+	pl, err := fetchPlaylist(ctx, srv.Client(), srv.URL+"/master.m3u8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pl.URL != srv.URL+"/high/index.m3u8" {
+		t.Errorf("expected the highest bandwidth rendition, got %s", pl.URL)
+	}
+	if pl.Rendition == nil || pl.Rendition.Bandwidth != 2500000 {
+		t.Errorf("expected the 2500000 bps rendition, got %+v", pl.Rendition)
+	}
+
+	k1 := &segmentKey{Method: "AES-128", URI: srv.URL + "/keys/k1", IV: []byte{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15}}
+	k2 := &segmentKey{Method: "AES-128", URI: srv.URL + "/high/k2"}
+	want := []segment{
+		{URL: srv.URL + "/high/seg7.ts", Duration: 10, Sequence: 7},
+		{URL: srv.URL + "/high/seg8.ts", Duration: 9.5, Sequence: 8, Key: k1},
+		{URL: "https://cdn.example.com/seg9.ts", Duration: 4, Sequence: 9, Key: k2},
+		{URL: srv.URL + "/high/seg10.ts", Duration: 2.5, Sequence: 10},
+	}
+	if !reflect.DeepEqual(pl.Segments, want) {
+		t.Errorf("unexpected segments:\n%+v\nexpected:\n%+v", pl.Segments, want)
+	}
+	if d := pl.duration(); d != 26*time.Second {
+		t.Errorf("expected a 26s duration, got %v", d)
+	}
+	if size := pl.estimatedSize(); size != 26*2500000/8 {
+		t.Errorf("expected a %d bytes estimate, got %d", 26*2500000/8, size)
+	}
+
+	for _, path := range []string{"/aes.m3u8", "/bad-iv.m3u8", "/text.m3u8", "/missing.m3u8"} {
+		if _, err := fetchPlaylist(ctx, srv.Client(), srv.URL+path); err == nil {
+			t.Errorf("%s: expected an error", path)
+		}
+	}
+}
+
+func TestSplitAttributes(t *testing.T) {
+	got := splitAttributes(`METHOD=AES-128, URI="https://example.com/key?a=1,b=2",IV=0x01`)
+	want := []string{"METHOD=AES-128", `URI="https://example.com/key?a=1,b=2"`, "IV=0x01"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+}
+
+func TestPlaylistEstimatedSizeWithoutBandwidth(t *testing.T) {
+	pl := &playlist{Segments: []segment{{Duration: 10}}}
+	if size := pl.estimatedSize(); size != 0 {
+		t.Errorf("expected no estimate without a rendition, got %d", size)
+	}
+}
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	progressBarWidth = 30
+	// ttyRefreshInterval is how often the progress bars are redrawn.
+	ttyRefreshInterval = 200 * time.Millisecond
+)
+
+// ProgressInterval is how often a progress line is printed when the output
+// isn't a terminal.
+var ProgressInterval = 10 * time.Second
+
+// progress reports the download progress of the current episode and of the
+// whole show. On a terminal the bars are redrawn in place, otherwise a plain
+// line is printed periodically.
+type progress struct {
+	out io.Writer
+	tty bool
+
+	mu       sync.Mutex
+	drawn    bool
+	start    time.Time
+	episodes int
+	finished int
+	bytes    int64
+	episode  *episodeProgress
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+type episodeProgress struct {
+	title        string
+	segments     int
+	segmentsDone int
+	bytes        int64
+	start        time.Time
+	// speed is a moving average of the throughput in bytes per second.
+	speed     float64
+	lastBytes int64
+	lastTick  time.Time
+}
+
+func newProgress(out *os.File, episodes int) *progress {
+	p := &progress{
+		out:      out,
+		tty:      isTerminal(out),
+		start:    time.Now(),
+		episodes: episodes,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	go p.loop()
+	return p
+}
+
+// isTerminal reports whether the file is a character device.
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return fi.Mode()&os.ModeCharDevice != 0
+}
+
+func (p *progress) loop() {
+	defer close(p.done)
+	interval := ProgressInterval
+	if p.tty {
+		interval = ttyRefreshInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-p.stop:
+			return
+		case <-ticker.C:
+			p.mu.Lock()
+			p.render()
+			p.mu.Unlock()
+		}
+	}
+}
+
+// StartEpisode starts reporting the progress of a new episode.
+func (p *progress) StartEpisode(title string, segments int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := time.Now()
+	p.episode = &episodeProgress{title: title, segments: segments, start: now, lastTick: now}
+}
+
+// FinishEpisode marks the current episode as done.
+func (p *progress) FinishEpisode() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.render()
+	p.finished++
+	p.episode = nil
+}
+
+// SegmentDone records a downloaded segment of the current episode.
+func (p *progress) SegmentDone() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.episode != nil {
+		p.episode.segmentsDone++
+	}
+}
+
+// AddBytes records downloaded bytes.
+func (p *progress) AddBytes(n int64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.bytes += n
+	if p.episode != nil {
+		p.episode.bytes += n
+	}
+}
+
+// Suspend clears the progress bars while write prints something, they are
+// redrawn afterwards.
+func (p *progress) Suspend(write func()) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.clear()
+	write()
+	p.drawn = false
+	if p.tty {
+		p.render()
+	}
+}
+
+// Close stops the progress reporting and prints the final state.
+func (p *progress) Close() {
+	close(p.stop)
+	<-p.done
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.render()
+	if p.tty {
+		fmt.Fprintln(p.out)
+	}
+}
+
+// clear erases the progress bars drawn on the terminal.
+func (p *progress) clear() {
+	if !p.tty || !p.drawn {
+		return
+	}
+	fmt.Fprint(p.out, "\r\033[2K\033[1A\033[2K")
+}
+
+func (p *progress) render() {
+	episodeLine := ""
+	if ep := p.episode; ep != nil {
+		ep.updateSpeed()
+		episodeLine = ep.String()
+	}
+	showLine := fmt.Sprintf("%s %d/%d episodes | %s | %s elapsed",
+		bar(float64(p.finished), float64(p.episodes)), p.finished, p.episodes,
+		formatBytes(p.bytes), time.Since(p.start).Round(time.Second))
+
+	if !p.tty {
+		if episodeLine != "" {
+			fmt.Fprintln(p.out, episodeLine)
+		}
+		fmt.Fprintln(p.out, showLine)
+		return
+	}
+	p.clear()
+	fmt.Fprintf(p.out, "%s\n%s", episodeLine, showLine)
+	p.drawn = true
+}
+
+func (ep *episodeProgress) updateSpeed() {
+	now := time.Now()
+	elapsed := now.Sub(ep.lastTick).Seconds()
+	if elapsed <= 0 {
+		return
+	}
+	current := float64(ep.bytes-ep.lastBytes) / elapsed
+	if ep.speed == 0 {
+		ep.speed = current
+	} else {
+		ep.speed = 0.3*current + 0.7*ep.speed
+	}
+	ep.lastBytes = ep.bytes
+	ep.lastTick = now
+}
+
+// eta estimates the remaining time based on the average segment size and
+// the current throughput.
+func (ep *episodeProgress) eta() string {
+	if ep.segmentsDone == 0 || ep.speed <= 0 {
+		return "--"
+	}
+	perSegment := float64(ep.bytes) / float64(ep.segmentsDone)
+	remaining := perSegment * float64(ep.segments-ep.segmentsDone)
+	return (time.Duration(remaining/ep.speed) * time.Second).Round(time.Second).String()
+}
+
+func (ep *episodeProgress) String() string {
+	return fmt.Sprintf("%s %s %d/%d segments | %s | %s/s | ETA %s",
+		ep.title, bar(float64(ep.segmentsDone), float64(ep.segments)),
+		ep.segmentsDone, ep.segments, formatBytes(ep.bytes), formatBytes(int64(ep.speed)), ep.eta())
+}
+
+func bar(done, total float64) string {
+	filled := 0
+	if total > 0 {
+		filled = int(done / total * progressBarWidth)
+	}
+	if filled > progressBarWidth {
+		filled = progressBarWidth
+	}
+	return "[" + strings.Repeat("=", filled) + strings.Repeat(" ", progressBarWidth-filled) + "]"
+}
+
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%dB", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f%ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// Provider knows how to list and download the episodes of a website.
+type Provider interface {
+	// Name identifies the provider.
+	Name() string
+	// Match reports whether the provider handles the URL.
+	Match(u *url.URL) bool
+	// ListShow returns the show, with the episodes available at the URL.
+	ListShow(ctx context.Context, u *url.URL) (*Show, error)
+	// Metadata returns what is known about the episode.
+	Metadata(ctx context.Context, ep Episode) (*Episode, error)
+	// ResolveMedia returns the HLS stream of the episode.
+	ResolveMedia(ctx context.Context, ep Episode) (*MediaStream, error)
+}
+
+// providers are the registered providers, in order of precedence.
+var providers []Provider
+
+func registerProvider(p Provider) {
+	providers = append(providers, p)
+}
+
+// providerByName returns the provider with the passed name, including the
+// media provider which doesn't match any URL.
+func providerByName(name string) (Provider, error) {
+	all := append([]Provider{&mediaProvider{}}, providers...)
+	for _, p := range all {
+		if p.Name() == name {
+			return p, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown provider %s", name)
+}
+
+// unavailableError is returned when a media can't be downloaded at all, for
+// instance when it expired or isn't available in the region.
+type unavailableError struct {
+	reason string
+}
+
+func (e *unavailableError) Error() string {
+	return e.reason
+}
+
+func isUnavailable(err error) bool {
+	_, ok := err.(*unavailableError)
+	return ok
+}
+
+// providerFor returns the provider handling the passed URL.
+func providerFor(rawURL string) (Provider, *url.URL, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid URL %s - %v", rawURL, err)
+	}
+	if u.Host == "" {
+		return nil, nil, fmt.Errorf("%s isn't an absolute URL", rawURL)
+	}
+	names := make([]string, len(providers))
+	for i, p := range providers {
+		if p.Match(u) {
+			return p, u, nil
+		}
+		names[i] = p.Name()
+	}
+	return nil, nil, fmt.Errorf("unsupported URL %s, supported providers: %s", rawURL, strings.Join(names, ", "))
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Application codes identifying the media catalogues of the validation
+// service.
+const (
+	medianetAppCode = "medianet"
+	gemAppCode      = "gem"
+)
+
+// rccValidationURL is the endpoint returning the playlist URL of a media.
+const rccValidationURL = "https://api.radio-canada.ca/validationMedia/v1/Validation.html"
+
+// validationParams are the parameters of the validation service picking the
+// catalogue and the stream format, the device type in particular changes the
+// formats, CDNs and resolutions returned. Empty fields are unset.
+type validationParams struct {
+	AppCode        string
+	DeviceType     string
+	ConnectionType string
+	Multibitrate   string
+}
+
+var (
+	// ValidationDefaults are the parameters used when neither the provider,
+	// the item nor the user set them.
+	ValidationDefaults = validationParams{
+		AppCode:        medianetAppCode,
+		DeviceType:     "ipad",
+		ConnectionType: "broadband",
+		Multibitrate:   "true",
+	}
+	// ValidationProfiles are the device profiles tried in order, the next one
+	// is used when a profile yields no URL.
+	ValidationProfiles = []validationParams{
+		{DeviceType: "ipad", ConnectionType: "broadband"},
+		{DeviceType: "ipad", ConnectionType: "hd"},
+		{DeviceType: "androidams", ConnectionType: "broadband"},
+		{DeviceType: "iphone4", ConnectionType: "wifi"},
+	}
+	// ValidationOverrides are set by the user and win over the providers,
+	// the items and the profiles.
+	ValidationOverrides validationParams
+)
+
+// merge returns the parameters with the fields set in o replacing theirs.
+func (p validationParams) merge(o validationParams) validationParams {
+	if o.AppCode != "" {
+		p.AppCode = o.AppCode
+	}
+	if o.DeviceType != "" {
+		p.DeviceType = o.DeviceType
+	}
+	if o.ConnectionType != "" {
+		p.ConnectionType = o.ConnectionType
+	}
+	if o.Multibitrate != "" {
+		p.Multibitrate = o.Multibitrate
+	}
+	return p
+}
+
+// profiles returns the parameters to try in order for a media, the passed
+// parameters come from the provider and the item. The profiles made
+// identical by the overrides are only tried once, and none is tried when the
+// user picked the device.
+func (p validationParams) profiles() []validationParams {
+	base := ValidationDefaults.merge(p)
+	if ValidationOverrides.DeviceType != "" {
+		return []validationParams{base.merge(ValidationOverrides)}
+	}
+	var tried []validationParams
+	for _, profile := range append([]validationParams{{}}, ValidationProfiles...) {
+		params := base.merge(profile).merge(ValidationOverrides)
+		dup := false
+		for _, t := range tried {
+			dup = dup || t == params
+		}
+		if !dup {
+			tried = append(tried, params)
+		}
+	}
+	return tried
+}
+
+func (p validationParams) String() string {
+	return fmt.Sprintf("appCode=%s deviceType=%s connectionType=%s multibitrate=%s",
+		p.AppCode, p.DeviceType, p.ConnectionType, p.Multibitrate)
+}
+
+// rccMediaMetadataURL is the endpoint describing a media.
+const rccMediaMetadataURL = "https://services.radio-canada.ca/media/meta/v1/index.ashx?output=jsonObject&appCode=%s&idMedia=%s"
+
+// rccMediaMetadata fetches the metadata of a media, the returned map is keyed
+// by the metadata names (Title, Description, imageHR...).
+func rccMediaMetadata(ctx context.Context, id, appCode string) (map[string]string, error) {
+	if appCode == "" {
+		appCode = medianetAppCode
+	}
+	res, err := httpGet(ctx, http.DefaultClient, fmt.Sprintf(rccMediaMetadataURL, appCode, id))
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != 200 {
+		return nil, fmt.Errorf("status code error: %d %s", res.StatusCode, res.Status)
+	}
+	var data RCCMetaJSON
+	if err = json.NewDecoder(res.Body).Decode(&data); err != nil {
+		return nil, err
+	}
+	metas := map[string]string{}
+	for _, m := range data.Metas {
+		metas[m.Name] = m.Text
+	}
+	return metas, nil
+}
+
+// rccMediaStream asks the Radio-Canada validation service for the stream of
+// a media. The passed parameters, set by the provider and the item, are tried
+// first and the device profiles are used as fallbacks when no URL is
+// returned.
+func rccMediaStream(ctx context.Context, id string, params validationParams) (*MediaStream, error) {
+	l := loggerFrom(ctx)
+	var lastErr error
+	for _, profile := range params.profiles() {
+		data, err := rccValidation(ctx, id, profile)
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		switch {
+		case err != nil:
+			lastErr = err
+		case data.URL == "":
+			lastErr = &unavailableError{fmt.Sprintf("no URL returned for media %s - error code %d: %v", id, data.ErrorCode, data.Message)}
+		default:
+			l.Debugf("Media %s resolved with %s", id, profile)
+			return &MediaStream{IDMedia: id, AppCode: profile.AppCode, DeviceType: profile.DeviceType, URL: data.URL}, nil
+		}
+		l.Debugf("Validation of media %s with %s failed - %v", id, profile, lastErr)
+	}
+	return nil, lastErr
+}
+
+// rccMediaTitle looks for a title in the parameters returned by the
+// validation service.
+func rccMediaTitle(ctx context.Context, id, appCode string) (string, error) {
+	data, err := rccValidation(ctx, id, ValidationDefaults.merge(validationParams{AppCode: appCode}).merge(ValidationOverrides))
+	if err != nil {
+		return "", err
+	}
+	for _, param := range data.Params {
+		if strings.EqualFold(param.Name, "title") {
+			if title, ok := param.Value.(string); ok && title != "" {
+				return title, nil
+			}
+		}
+	}
+	return "", fmt.Errorf("no title returned for media %s", id)
+}
+
+func rccValidation(ctx context.Context, id string, params validationParams) (*RCCURLJSON, error) {
+	q := url.Values{}
+	q.Set("output", "json")
+	q.Set("appCode", params.AppCode)
+	q.Set("deviceType", params.DeviceType)
+	q.Set("connectionType", params.ConnectionType)
+	q.Set("multibitrate", params.Multibitrate)
+	q.Set("idMedia", id)
+	res, err := httpGet(ctx, http.DefaultClient, rccValidationURL+"?"+q.Encode())
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != 200 {
+		return nil, fmt.Errorf("status code error: %d %s", res.StatusCode, res.Status)
+	}
+	var data RCCURLJSON
+	if err = json.NewDecoder(res.Body).Decode(&data); err != nil {
+		return nil, err
+	}
+	return &data, nil
+}
+
+// RCCMetaJSON is the JSON structure returned by the media metadata service.
+type RCCMetaJSON struct {
+	Metas []struct {
+		Name string `json:"name"`
+		Text string `json:"text"`
+	} `json:"Metas"`
+}
+
+// RCCURLJSON is the JSON structure returned by the validation service.
+type RCCURLJSON struct {
+	URL       string      `json:"url"`
+	Message   interface{} `json:"message"`
+	ErrorCode int         `json:"errorCode"`
+	Params    []struct {
+		Name  string      `json:"name"`
+		Value interface{} `json:"value"`
+	} `json:"params"`
+	Bitrates []struct {
+		Bitrate int         `json:"bitrate"`
+		Width   int         `json:"width"`
+		Height  int         `json:"height"`
+		Lines   string      `json:"lines"`
+		Param   interface{} `json:"param"`
+	} `json:"bitrates"`
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestValidationProfiles(t *testing.T) {
+	defer func(o validationParams) { ValidationOverrides = o }(ValidationOverrides)
+	item := validationParams{AppCode: "toutv"}
+	tests := []struct {
+		name      string
+		overrides validationParams
+		want      []validationParams
+	}{
+		{
+			name: "fallback profiles",
+			want: []validationParams{
+				{AppCode: "toutv", DeviceType: "ipad", ConnectionType: "broadband", Multibitrate: "true"},
+				{AppCode: "toutv", DeviceType: "ipad", ConnectionType: "hd", Multibitrate: "true"},
+				{AppCode: "toutv", DeviceType: "androidams", ConnectionType: "broadband", Multibitrate: "true"},
+				{AppCode: "toutv", DeviceType: "iphone4", ConnectionType: "wifi", Multibitrate: "true"},
+			},
+		},
+		{
+			name:      "connection type",
+			overrides: validationParams{ConnectionType: "hd"},
+			want: []validationParams{
+				{AppCode: "toutv", DeviceType: "ipad", ConnectionType: "hd", Multibitrate: "true"},
+				{AppCode: "toutv", DeviceType: "androidams", ConnectionType: "hd", Multibitrate: "true"},
+				{AppCode: "toutv", DeviceType: "iphone4", ConnectionType: "hd", Multibitrate: "true"},
+			},
+		},
+		{
+			name:      "device type",
+			overrides: validationParams{DeviceType: "androidams"},
+			want: []validationParams{
+				{AppCode: "toutv", DeviceType: "androidams", ConnectionType: "broadband", Multibitrate: "true"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ValidationOverrides = tt.overrides
+			if got := item.profiles(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,65 @@
+package remux
+
+import "errors"
+
+// aacFrameSamples is the number of PCM samples per AAC frame.
+const aacFrameSamples = 1024
+
+var adtsSampleRates = []int{
+	96000, 88200, 64000, 48000, 44100, 32000, 24000, 22050, 16000, 12000, 11025, 8000, 7350,
+}
+
+var (
+	errADTSShort = errors.New("ADTS header too short")
+	errADTSSync  = errors.New("ADTS sync word not found")
+)
+
+// adtsHeader is a parsed ADTS frame header.
+type adtsHeader struct {
+	profile         byte
+	sampleRateIndex byte
+	channelConfig   byte
+	headerLen       int
+	frameLen        int
+}
+
+// parseADTSHeader parses the ADTS header at the start of b.
+func parseADTSHeader(b []byte) (h adtsHeader, err error) {
+	if len(b) < 7 {
+		return h, errADTSShort
+	}
+	if b[0] != 0xff || b[1]&0xf0 != 0xf0 {
+		return h, errADTSSync
+	}
+	h.headerLen = 7
+	if b[1]&0x01 == 0 {
+		// CRC present
+		h.headerLen = 9
+	}
+	h.profile = b[2] >> 6
+	h.sampleRateIndex = (b[2] >> 2) & 0x0f
+	h.channelConfig = (b[2]&0x01)<<2 | b[3]>>6
+	h.frameLen = int(b[3]&0x03)<<11 | int(b[4])<<3 | int(b[5])>>5
+	if int(h.sampleRateIndex) >= len(adtsSampleRates) {
+		return h, errors.New("invalid ADTS sample rate index")
+	}
+	if h.frameLen < h.headerLen {
+		return h, errors.New("invalid ADTS frame length")
+	}
+	return h, nil
+}
+
+func (h adtsHeader) sampleRate() int {
+	return adtsSampleRates[h.sampleRateIndex]
+}
+
+// audioSpecificConfig converts the ADTS header into the MPEG-4
+// AudioSpecificConfig stored in the MP4 sample description. This is what
+// ffmpeg's aac_adtstoasc bitstream filter does.
+func (h adtsHeader) audioSpecificConfig() []byte {
+	objectType := h.profile + 1
+	return []byte{
+		objectType<<3 | h.sampleRateIndex>>1,
+		(h.sampleRateIndex&0x01)<<7 | h.channelConfig<<3,
+	}
+}
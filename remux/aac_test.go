@@ -0,0 +1,118 @@
+package remux
+
+import (
+	"bytes"
+	"testing"
+)
+
+// adtsFrame builds an ADTS frame carrying payloadLen zero bytes.
+func adtsFrame(profile, sampleRateIndex, channels byte, payloadLen int, crc bool) []byte {
+	headerLen := 7
+	if crc {
+		headerLen = 9
+	}
+	frameLen := headerLen + payloadLen
+	b := make([]byte, frameLen)
+	b[0] = 0xff
+	b[1] = 0xf1
+	if crc {
+		b[1] = 0xf0
+	}
+	b[2] = profile<<6 | sampleRateIndex<<2 | channels>>2
+	b[3] = (channels&0x03)<<6 | byte(frameLen>>11)&0x03
+	b[4] = byte(frameLen >> 3)
+	b[5] = byte(frameLen)<<5 | 0x1f
+	b[6] = 0xfc
+	return b
+}
+
+func TestParseADTSHeader(t *testing.T) {
+	tests := []struct {
+		name  string
+		data  []byte
+		want  adtsHeader
+		err   bool
+		short bool
+		sync  bool
+	}{
+		{
+			name: "AAC LC 44.1kHz stereo",
+			data: adtsFrame(1, 4, 2, 100, false),
+			want: adtsHeader{profile: 1, sampleRateIndex: 4, channelConfig: 2, headerLen: 7, frameLen: 107},
+		},
+		{
+			name: "CRC present",
+			data: adtsFrame(1, 3, 1, 20, true),
+			want: adtsHeader{profile: 1, sampleRateIndex: 3, channelConfig: 1, headerLen: 9, frameLen: 29},
+		},
+		{
+			name: "6 channels",
+			data: adtsFrame(1, 3, 6, 10, false),
+			want: adtsHeader{profile: 1, sampleRateIndex: 3, channelConfig: 6, headerLen: 7, frameLen: 17},
+		},
+		{
+			name:  "too short",
+			data:  []byte{0xff, 0xf1, 0x50},
+			err:   true,
+			short: true,
+		},
+		{
+			name: "no sync word",
+			data: []byte{0x00, 0xf1, 0x50, 0x80, 0x0d, 0xff, 0xfc},
+			err:  true,
+			sync: true,
+		},
+		{
+			name: "invalid sample rate index",
+			data: adtsFrame(1, 15, 2, 10, false),
+			err:  true,
+		},
+		{
+			name: "frame shorter than its header",
+			data: func() []byte {
+				b := adtsFrame(1, 4, 2, 0, false)
+				b[4], b[5] = 0, 3<<5
+				return b
+			}(),
+			err: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, err := parseADTSHeader(tt.data)
+			if (err != nil) != tt.err {
+				t.Fatalf("expected error %v, got %v", tt.err, err)
+			}
+			if tt.short != (err == errADTSShort) {
+				t.Errorf("expected errADTSShort %v, got %v", tt.short, err)
+			}
+			if tt.sync != (err == errADTSSync) {
+				t.Errorf("expected errADTSSync %v, got %v", tt.sync, err)
+			}
+			if err == nil && h != tt.want {
+				t.Errorf("expected %+v, got %+v", tt.want, h)
+			}
+		})
+	}
+}
+
+func TestAudioSpecificConfig(t *testing.T) {
+	tests := []struct {
+		h    adtsHeader
+		want []byte
+	}{
+		// AAC LC, 44.1kHz, stereo
+		{adtsHeader{profile: 1, sampleRateIndex: 4, channelConfig: 2}, []byte{0x12, 0x10}},
+		// AAC LC, 48kHz, stereo
+		{adtsHeader{profile: 1, sampleRateIndex: 3, channelConfig: 2}, []byte{0x11, 0x90}},
+		// AAC Main, 22.05kHz, mono
+		{adtsHeader{profile: 0, sampleRateIndex: 7, channelConfig: 1}, []byte{0x0b, 0x88}},
+		// AAC LC, 8kHz, 5.1
+		{adtsHeader{profile: 1, sampleRateIndex: 11, channelConfig: 6}, []byte{0x15, 0xb0}},
+	}
+	for _, tt := range tests {
+		if got := tt.h.audioSpecificConfig(); !bytes.Equal(got, tt.want) {
+			t.Errorf("%+v: expected % x, got % x", tt.h, tt.want, got)
+		}
+	}
+}
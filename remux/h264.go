@@ -0,0 +1,199 @@
+package remux
+
+import "errors"
+
+const (
+	nalIDR = 5
+	nalSPS = 7
+	nalPPS = 8
+	nalAUD = 9
+)
+
+// splitNALUnits splits an Annex B byte stream into NAL units (without their
+// start codes).
+func splitNALUnits(b []byte) [][]byte {
+	var nals [][]byte
+	start := -1
+	for i := 0; i+2 < len(b); i++ {
+		if b[i] != 0 || b[i+1] != 0 || b[i+2] != 1 {
+			continue
+		}
+		if start >= 0 {
+			nals = appendNAL(nals, b[start:i])
+		}
+		i += 2
+		start = i + 1
+	}
+	if start >= 0 && start < len(b) {
+		nals = appendNAL(nals, b[start:])
+	}
+	return nals
+}
+
+// appendNAL appends the NAL unit after trimming the trailing zero bytes that
+// belong to the next 4-byte start code.
+func appendNAL(nals [][]byte, nal []byte) [][]byte {
+	for len(nal) > 0 && nal[len(nal)-1] == 0 {
+		nal = nal[:len(nal)-1]
+	}
+	if len(nal) == 0 {
+		return nals
+	}
+	return append(nals, nal)
+}
+
+// spsInfo is the subset of a sequence parameter set needed to describe the
+// video track.
+type spsInfo struct {
+	width  int
+	height int
+}
+
+// parseSPS extracts the picture dimensions from a SPS NAL unit.
+func parseSPS(nal []byte) (info spsInfo, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = errors.New("truncated SPS")
+		}
+	}()
+	if len(nal) < 4 {
+		return info, errors.New("SPS too short")
+	}
+	br := &bitReader{b: unescapeRBSP(nal[1:])}
+	profile := br.u(8)
+	br.u(16) // constraint flags and level
+	br.ue()  // seq_parameter_set_id
+
+	chromaFormat := 1
+	separateColourPlane := 0
+	switch profile {
+	case 100, 110, 122, 244, 44, 83, 86, 118, 128, 138, 139, 134, 135:
+		chromaFormat = br.ue()
+		if chromaFormat == 3 {
+			separateColourPlane = br.u(1)
+		}
+		br.ue() // bit_depth_luma_minus8
+		br.ue() // bit_depth_chroma_minus8
+		br.u(1) // qpprime_y_zero_transform_bypass_flag
+		if br.u(1) == 1 {
+			lists := 8
+			if chromaFormat == 3 {
+				lists = 12
+			}
+			for i := 0; i < lists; i++ {
+				if br.u(1) == 0 {
+					continue
+				}
+				size := 16
+				if i >= 6 {
+					size = 64
+				}
+				last, next := 8, 8
+				for j := 0; j < size; j++ {
+					if next != 0 {
+						next = (last + br.se() + 256) % 256
+					}
+					if next != 0 {
+						last = next
+					}
+				}
+			}
+		}
+	}
+
+	br.ue() // log2_max_frame_num_minus4
+	switch br.ue() {
+	case 0:
+		br.ue() // log2_max_pic_order_cnt_lsb_minus4
+	case 1:
+		br.u(1) // delta_pic_order_always_zero_flag
+		br.se() // offset_for_non_ref_pic
+		br.se() // offset_for_top_to_bottom_field
+		n := br.ue()
+		for i := 0; i < n; i++ {
+			br.se()
+		}
+	}
+	br.ue() // max_num_ref_frames
+	br.u(1) // gaps_in_frame_num_value_allowed_flag
+	widthMbs := br.ue() + 1
+	heightMapUnits := br.ue() + 1
+	frameMbsOnly := br.u(1)
+	if frameMbsOnly == 0 {
+		br.u(1) // mb_adaptive_frame_field_flag
+	}
+	br.u(1) // direct_8x8_inference_flag
+
+	info.width = widthMbs * 16
+	info.height = (2 - frameMbsOnly) * heightMapUnits * 16
+	if br.u(1) == 1 {
+		left, right, top, bottom := br.ue(), br.ue(), br.ue(), br.ue()
+		cropX, cropY := 1, 2-frameMbsOnly
+		if separateColourPlane == 0 {
+			switch chromaFormat {
+			case 1:
+				cropX, cropY = 2, 2*(2-frameMbsOnly)
+			case 2:
+				cropX, cropY = 2, 2-frameMbsOnly
+			}
+		}
+		info.width -= (left + right) * cropX
+		info.height -= (top + bottom) * cropY
+	}
+	return info, nil
+}
+
+// unescapeRBSP removes the emulation prevention bytes from a NAL unit.
+func unescapeRBSP(b []byte) []byte {
+	out := make([]byte, 0, len(b))
+	zeros := 0
+	for _, c := range b {
+		if zeros >= 2 && c == 0x03 {
+			zeros = 0
+			continue
+		}
+		if c == 0 {
+			zeros++
+		} else {
+			zeros = 0
+		}
+		out = append(out, c)
+	}
+	return out
+}
+
+// bitReader reads Exp-Golomb coded values. It panics when reading past the
+// end of the buffer, callers are expected to recover.
+type bitReader struct {
+	b   []byte
+	pos int
+}
+
+func (r *bitReader) u(n int) int {
+	v := 0
+	for i := 0; i < n; i++ {
+		bit := (r.b[r.pos>>3] >> (7 - uint(r.pos&7))) & 1
+		v = v<<1 | int(bit)
+		r.pos++
+	}
+	return v
+}
+
+func (r *bitReader) ue() int {
+	zeros := 0
+	for r.u(1) == 0 {
+		zeros++
+		if zeros > 31 {
+			panic("invalid exp-golomb code")
+		}
+	}
+	return (1 << uint(zeros)) - 1 + r.u(zeros)
+}
+
+func (r *bitReader) se() int {
+	v := r.ue()
+	if v&1 == 1 {
+		return (v + 1) / 2
+	}
+	return -v / 2
+}
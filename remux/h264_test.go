@@ -0,0 +1,212 @@
+package remux
+
+import (
+	"bytes"
+	"testing"
+)
+
+// bitWriter writes the Exp-Golomb coded values bitReader reads.
+type bitWriter struct {
+	b []byte
+	n int
+}
+
+func (w *bitWriter) u(n int, v int) {
+	for i := n - 1; i >= 0; i-- {
+		if w.n%8 == 0 {
+			w.b = append(w.b, 0)
+		}
+		if v>>uint(i)&1 == 1 {
+			w.b[len(w.b)-1] |= 0x80 >> uint(w.n%8)
+		}
+		w.n++
+	}
+}
+
+func (w *bitWriter) ue(v int) {
+	v++
+	bits := 0
+	for x := v; x > 0; x >>= 1 {
+		bits++
+	}
+	w.u(bits-1, 0)
+	w.u(bits, v)
+}
+
+// spsParams describes the SPS built by buildSPS.
+type spsParams struct {
+	profile        int
+	widthMbs       int
+	heightMapUnits int
+	frameMbsOnly   bool
+	crop           []int // left, right, top, bottom
+}
+
+// buildSPS encodes a minimal SPS NAL unit, with emulation prevention bytes.
+func buildSPS(p spsParams) []byte {
+	w := &bitWriter{}
+	w.u(8, p.profile)
+	w.u(8, 0)  // constraint flags
+	w.u(8, 40) // level
+	w.ue(0)    // seq_parameter_set_id
+	if p.profile == 100 {
+		w.ue(1)   // chroma_format_idc
+		w.ue(0)   // bit_depth_luma_minus8
+		w.ue(0)   // bit_depth_chroma_minus8
+		w.u(1, 0) // qpprime_y_zero_transform_bypass_flag
+		w.u(1, 0) // seq_scaling_matrix_present_flag
+	}
+	w.ue(0)   // log2_max_frame_num_minus4
+	w.ue(0)   // pic_order_cnt_type
+	w.ue(0)   // log2_max_pic_order_cnt_lsb_minus4
+	w.ue(1)   // max_num_ref_frames
+	w.u(1, 0) // gaps_in_frame_num_value_allowed_flag
+	w.ue(p.widthMbs - 1)
+	w.ue(p.heightMapUnits - 1)
+	if p.frameMbsOnly {
+		w.u(1, 1)
+	} else {
+		w.u(1, 0)
+		w.u(1, 0) // mb_adaptive_frame_field_flag
+	}
+	w.u(1, 1) // direct_8x8_inference_flag
+	if p.crop != nil {
+		w.u(1, 1)
+		for _, c := range p.crop {
+			w.ue(c)
+		}
+	} else {
+		w.u(1, 0)
+	}
+	w.u(1, 0) // vui_parameters_present_flag
+	w.u(1, 1) // rbsp_stop_one_bit
+
+	nal := []byte{0x67}
+	zeros := 0
+	for _, c := range w.b {
+		if zeros >= 2 && c <= 0x03 {
+			nal = append(nal, 0x03)
+			zeros = 0
+		}
+		if c == 0 {
+			zeros++
+		} else {
+			zeros = 0
+		}
+		nal = append(nal, c)
+	}
+	return nal
+}
+
+func TestSplitNALUnits(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		want [][]byte
+	}{
+		{
+			name: "3 byte start codes",
+			data: []byte{0, 0, 1, 0x09, 0xf0, 0, 0, 1, 0x67, 0x42},
+			want: [][]byte{{0x09, 0xf0}, {0x67, 0x42}},
+		},
+		{
+			name: "4 byte start codes",
+			data: []byte{0, 0, 0, 1, 0x67, 0x42, 0, 0, 0, 1, 0x68, 0xce, 0, 0, 0, 1, 0x65, 0x88},
+			want: [][]byte{{0x67, 0x42}, {0x68, 0xce}, {0x65, 0x88}},
+		},
+		{
+			name: "leading garbage",
+			data: []byte{0xaa, 0xbb, 0, 0, 1, 0x65, 0x88},
+			want: [][]byte{{0x65, 0x88}},
+		},
+		{
+			name: "empty NAL units",
+			data: []byte{0, 0, 1, 0, 0, 1, 0x41, 0x9a, 0, 0, 1},
+			want: [][]byte{{0x41, 0x9a}},
+		},
+		{
+			name: "no start code",
+			data: []byte{0x65, 0x88, 0x84},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := splitNALUnits(tt.data)
+			if len(got) != len(tt.want) {
+				t.Fatalf("expected %d NAL units, got %d: % x", len(tt.want), len(got), got)
+			}
+			for i := range got {
+				if !bytes.Equal(got[i], tt.want[i]) {
+					t.Errorf("NAL unit %d: expected % x, got % x", i, tt.want[i], got[i])
+				}
+			}
+		})
+	}
+}
+
+func TestParseSPS(t *testing.T) {
+	tests := []struct {
+		name          string
+		sps           spsParams
+		width, height int
+	}{
+		{
+			name:   "baseline 1280x720",
+			sps:    spsParams{profile: 66, widthMbs: 80, heightMapUnits: 45, frameMbsOnly: true},
+			width:  1280,
+			height: 720,
+		},
+		{
+			name:   "main 1920x1080 cropped",
+			sps:    spsParams{profile: 77, widthMbs: 120, heightMapUnits: 68, frameMbsOnly: true, crop: []int{0, 0, 0, 4}},
+			width:  1920,
+			height: 1080,
+		},
+		{
+			name:   "high 1920x1080 cropped",
+			sps:    spsParams{profile: 100, widthMbs: 120, heightMapUnits: 68, frameMbsOnly: true, crop: []int{0, 0, 0, 4}},
+			width:  1920,
+			height: 1080,
+		},
+		{
+			name:   "high interlaced 1920x1080 cropped",
+			sps:    spsParams{profile: 100, widthMbs: 120, heightMapUnits: 34, crop: []int{0, 0, 0, 2}},
+			width:  1920,
+			height: 1080,
+		},
+		{
+			name:   "cropped on every side",
+			sps:    spsParams{profile: 66, widthMbs: 40, heightMapUnits: 30, frameMbsOnly: true, crop: []int{2, 3, 1, 1}},
+			width:  640 - 10,
+			height: 480 - 4,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			info, err := parseSPS(buildSPS(tt.sps))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if info.width != tt.width || info.height != tt.height {
+				t.Errorf("expected %dx%d, got %dx%d", tt.width, tt.height, info.width, info.height)
+			}
+		})
+	}
+}
+
+func TestParseSPSTruncated(t *testing.T) {
+	sps := buildSPS(spsParams{profile: 100, widthMbs: 120, heightMapUnits: 68, frameMbsOnly: true})
+	for _, n := range []int{2, 5, 7} {
+		if _, err := parseSPS(sps[:n]); err == nil {
+			t.Errorf("expected an error for a %d bytes SPS", n)
+		}
+	}
+}
+
+func TestUnescapeRBSP(t *testing.T) {
+	got := unescapeRBSP([]byte{0x42, 0, 0, 3, 1, 0, 0, 3, 0, 0, 3})
+	want := []byte{0x42, 0, 0, 1, 0, 0, 0, 0}
+	if !bytes.Equal(got, want) {
+		t.Errorf("expected % x, got % x", want, got)
+	}
+}
@@ -0,0 +1,472 @@
+package remux
+
+import (
+	"encoding/binary"
+)
+
+const (
+	movieTimescale = 1000
+	videoTimescale = 90000
+	// defaultFrameDuration is used when the frame duration can't be derived
+	// from the timestamps (30fps at 90kHz).
+	defaultFrameDuration = 3000
+)
+
+type sample struct {
+	size uint32
+	// dts and pts are expressed in the track timescale.
+	dts  int64
+	pts  int64
+	sync bool
+}
+
+type chunk struct {
+	offset  int64
+	samples uint32
+}
+
+// track holds the sample tables of a MP4 track while the mdat is written.
+type track struct {
+	id        uint32
+	handler   string
+	timescale uint32
+	samples   []sample
+	chunks    []chunk
+
+	// video
+	sps, pps      []byte
+	width, height int
+
+	// audio
+	asc          []byte
+	channels     int
+	sampleRate   int
+	pending      []byte
+	startPTS     int64
+	nextDTS      int64
+	lastPTS      int64
+	ptsWrapDelta int64
+}
+
+// unwrap extends a 33-bit MPEG timestamp so it keeps increasing after it
+// wraps around.
+func (t *track) unwrap(ts int64) int64 {
+	const wrap = 1 << 33
+	ts += t.ptsWrapDelta
+	if t.lastPTS != 0 && ts < t.lastPTS-wrap/2 {
+		t.ptsWrapDelta += wrap
+		ts += wrap
+	}
+	t.lastPTS = ts
+	return ts
+}
+
+// durations returns the duration of each sample in the track timescale.
+func (t *track) durations() []uint32 {
+	d := make([]uint32, len(t.samples))
+	if t.handler == "soun" {
+		// the frames before a gap last until the next one
+		for i := range d {
+			d[i] = aacFrameSamples
+			if i+1 < len(t.samples) {
+				d[i] = uint32(t.samples[i+1].dts - t.samples[i].dts)
+			}
+		}
+		return d
+	}
+	last := int64(defaultFrameDuration)
+	for i := range t.samples {
+		if i+1 < len(t.samples) {
+			if delta := t.samples[i+1].dts - t.samples[i].dts; delta > 0 {
+				last = delta
+			}
+		}
+		d[i] = uint32(last)
+	}
+	return d
+}
+
+// mediaStart returns the composition time of the first presented sample
+// and the first decode time, in the track timescale.
+func (t *track) mediaStart() (minPTS, firstDTS int64) {
+	if len(t.samples) == 0 {
+		return 0, 0
+	}
+	firstDTS = t.samples[0].dts
+	minPTS = t.samples[0].pts
+	for _, s := range t.samples {
+		if s.pts < minPTS {
+			minPTS = s.pts
+		}
+	}
+	return minPTS, firstDTS
+}
+
+// buf is a big endian byte buffer used to build boxes.
+type buf []byte
+
+func (b *buf) u8(v uint8)   { *b = append(*b, v) }
+func (b *buf) u16(v uint16) { *b = append(*b, byte(v>>8), byte(v)) }
+func (b *buf) u32(v uint32) {
+	*b = append(*b, 0, 0, 0, 0)
+	binary.BigEndian.PutUint32((*b)[len(*b)-4:], v)
+}
+func (b *buf) u64(v uint64) {
+	*b = append(*b, 0, 0, 0, 0, 0, 0, 0, 0)
+	binary.BigEndian.PutUint64((*b)[len(*b)-8:], v)
+}
+func (b *buf) bytes(v []byte) { *b = append(*b, v...) }
+func (b *buf) zeros(n int)    { *b = append(*b, make([]byte, n)...) }
+
+func box(typ string, children ...[]byte) []byte {
+	size := 8
+	for _, c := range children {
+		size += len(c)
+	}
+	b := make(buf, 0, size)
+	b.u32(uint32(size))
+	b.bytes([]byte(typ))
+	for _, c := range children {
+		b.bytes(c)
+	}
+	return b
+}
+
+func fullBox(typ string, version uint8, flags uint32, children ...[]byte) []byte {
+	hdr := buf{version, byte(flags >> 16), byte(flags >> 8), byte(flags)}
+	return box(typ, append([][]byte{hdr}, children...)...)
+}
+
+var unityMatrix = []uint32{0x00010000, 0, 0, 0, 0x00010000, 0, 0, 0, 0x40000000}
+
+func ftypBox() []byte {
+	var b buf
+	b.bytes([]byte("isom"))
+	b.u32(0x200)
+	b.bytes([]byte("isomiso2avc1mp41"))
+	return box("ftyp", b)
+}
+
+// moovBox builds the movie box. start is the earliest presentation time of
+// all tracks, in 90kHz units, and is used to keep the tracks in sync.
+func moovBox(tracks []*track, start int64) []byte {
+	var traks [][]byte
+	var movieDuration uint64
+	for _, t := range tracks {
+		trak, d := trakBox(t, start)
+		if d > movieDuration {
+			movieDuration = d
+		}
+		traks = append(traks, trak)
+	}
+
+	var b buf
+	b.u32(0) // creation time
+	b.u32(0) // modification time
+	b.u32(movieTimescale)
+	b.u32(uint32(movieDuration))
+	b.u32(0x00010000) // rate
+	b.u16(0x0100)     // volume
+	b.zeros(10)
+	for _, v := range unityMatrix {
+		b.u32(v)
+	}
+	b.zeros(24)
+	b.u32(uint32(len(tracks) + 1)) // next track id
+
+	return box("moov", append([][]byte{fullBox("mvhd", 0, 0, b)}, traks...)...)
+}
+
+// trakBox builds the track box and returns its presentation duration in the
+// movie timescale.
+func trakBox(t *track, start int64) ([]byte, uint64) {
+	durs := t.durations()
+	var mediaDuration uint64
+	for _, d := range durs {
+		mediaDuration += uint64(d)
+	}
+
+	// The edit list delays the track to its position relative to the
+	// other tracks and skips the initial composition offset of B-frames.
+	minPTS, firstDTS := t.mediaStart()
+	mediaTime := minPTS - firstDTS
+	emptyEdit := scale(minPTS-start, videoTimescale, movieTimescale)
+	if t.handler == "soun" {
+		mediaTime = 0
+		emptyEdit = scale(t.startPTS-start, videoTimescale, movieTimescale)
+	}
+	if emptyEdit < 0 {
+		emptyEdit = 0
+	}
+	editDuration := scale(int64(mediaDuration)-mediaTime, t.timescale, movieTimescale)
+	if editDuration < 0 {
+		editDuration = 0
+	}
+	duration := uint64(emptyEdit + editDuration)
+
+	var tkhd buf
+	tkhd.u32(0) // creation time
+	tkhd.u32(0) // modification time
+	tkhd.u32(t.id)
+	tkhd.u32(0)
+	tkhd.u32(uint32(duration))
+	tkhd.zeros(8)
+	tkhd.u16(0) // layer
+	tkhd.u16(0) // alternate group
+	if t.handler == "soun" {
+		tkhd.u16(0x0100)
+	} else {
+		tkhd.u16(0)
+	}
+	tkhd.u16(0)
+	for _, v := range unityMatrix {
+		tkhd.u32(v)
+	}
+	tkhd.u32(uint32(t.width) << 16)
+	tkhd.u32(uint32(t.height) << 16)
+
+	children := [][]byte{fullBox("tkhd", 0, 3, tkhd)}
+	if emptyEdit > 0 || mediaTime > 0 {
+		var elst buf
+		entries := uint32(1)
+		if emptyEdit > 0 {
+			entries++
+		}
+		elst.u32(entries)
+		if emptyEdit > 0 {
+			elst.u32(uint32(emptyEdit))
+			elst.u32(0xffffffff) // media time -1: empty edit
+			elst.u32(0x00010000)
+		}
+		elst.u32(uint32(editDuration))
+		elst.u32(uint32(mediaTime))
+		elst.u32(0x00010000)
+		children = append(children, box("edts", fullBox("elst", 0, 0, elst)))
+	}
+	children = append(children, mdiaBox(t, durs, mediaDuration))
+	return box("trak", children...), duration
+}
+
+func mdiaBox(t *track, durs []uint32, duration uint64) []byte {
+	var mdhd buf
+	mdhd.u32(0) // creation time
+	mdhd.u32(0) // modification time
+	mdhd.u32(t.timescale)
+	mdhd.u32(uint32(duration))
+	mdhd.u16(0x55c4) // "und"
+	mdhd.u16(0)
+
+	var hdlr buf
+	hdlr.u32(0)
+	hdlr.bytes([]byte(t.handler))
+	hdlr.zeros(12)
+	if t.handler == "soun" {
+		hdlr.bytes([]byte("SoundHandler\x00"))
+	} else {
+		hdlr.bytes([]byte("VideoHandler\x00"))
+	}
+
+	var mhd []byte
+	if t.handler == "soun" {
+		mhd = fullBox("smhd", 0, 0, make([]byte, 4))
+	} else {
+		mhd = fullBox("vmhd", 0, 1, make([]byte, 8))
+	}
+	dref := fullBox("dref", 0, 0, buf{0, 0, 0, 1}, fullBox("url ", 0, 1))
+	minf := box("minf", mhd, box("dinf", dref), stblBox(t, durs))
+
+	return box("mdia", fullBox("mdhd", 0, 0, mdhd), fullBox("hdlr", 0, 0, hdlr), minf)
+}
+
+func stblBox(t *track, durs []uint32) []byte {
+	children := [][]byte{stsdBox(t)}
+
+	// stts
+	var stts buf
+	var entries []uint32
+	for i, d := range durs {
+		if i > 0 && entries[len(entries)-1] == d {
+			entries[len(entries)-2]++
+			continue
+		}
+		entries = append(entries, 1, d)
+	}
+	stts.u32(uint32(len(entries) / 2))
+	for _, v := range entries {
+		stts.u32(v)
+	}
+	children = append(children, fullBox("stts", 0, 0, stts))
+
+	// ctts, only needed when frames are reordered
+	entries = entries[:0]
+	reordered := false
+	for i, s := range t.samples {
+		offset := s.pts - s.dts
+		if offset < 0 {
+			offset = 0
+		}
+		if offset != 0 {
+			reordered = true
+		}
+		if i > 0 && entries[len(entries)-1] == uint32(offset) {
+			entries[len(entries)-2]++
+			continue
+		}
+		entries = append(entries, 1, uint32(offset))
+	}
+	if reordered {
+		var ctts buf
+		ctts.u32(uint32(len(entries) / 2))
+		for _, v := range entries {
+			ctts.u32(v)
+		}
+		children = append(children, fullBox("ctts", 0, 0, ctts))
+	}
+
+	// stss, audio samples are all sync samples
+	if t.handler == "vide" {
+		var stss, list buf
+		var n uint32
+		for i, s := range t.samples {
+			if s.sync {
+				list.u32(uint32(i + 1))
+				n++
+			}
+		}
+		stss.u32(n)
+		stss.bytes(list)
+		children = append(children, fullBox("stss", 0, 0, stss))
+	}
+
+	// stsc
+	var stsc buf
+	var runs []uint32
+	for i, c := range t.chunks {
+		if i > 0 && runs[len(runs)-1] == c.samples {
+			continue
+		}
+		runs = append(runs, uint32(i+1), c.samples)
+	}
+	stsc.u32(uint32(len(runs) / 2))
+	for i := 0; i < len(runs); i += 2 {
+		stsc.u32(runs[i])
+		stsc.u32(runs[i+1])
+		stsc.u32(1) // sample description index
+	}
+	children = append(children, fullBox("stsc", 0, 0, stsc))
+
+	// stsz
+	var stsz buf
+	stsz.u32(0)
+	stsz.u32(uint32(len(t.samples)))
+	for _, s := range t.samples {
+		stsz.u32(s.size)
+	}
+	children = append(children, fullBox("stsz", 0, 0, stsz))
+
+	// stco or co64 depending on the size of the file
+	large := false
+	for _, c := range t.chunks {
+		if c.offset > 0xffffffff {
+			large = true
+			break
+		}
+	}
+	var co buf
+	co.u32(uint32(len(t.chunks)))
+	for _, c := range t.chunks {
+		if large {
+			co.u64(uint64(c.offset))
+		} else {
+			co.u32(uint32(c.offset))
+		}
+	}
+	if large {
+		children = append(children, fullBox("co64", 0, 0, co))
+	} else {
+		children = append(children, fullBox("stco", 0, 0, co))
+	}
+
+	return box("stbl", children...)
+}
+
+func stsdBox(t *track) []byte {
+	var entry []byte
+	if t.handler == "soun" {
+		entry = mp4aBox(t)
+	} else {
+		entry = avc1Box(t)
+	}
+	return fullBox("stsd", 0, 0, buf{0, 0, 0, 1}, entry)
+}
+
+func avc1Box(t *track) []byte {
+	var b buf
+	b.zeros(6)
+	b.u16(1) // data reference index
+	b.zeros(16)
+	b.u16(uint16(t.width))
+	b.u16(uint16(t.height))
+	b.u32(0x00480000) // 72 dpi
+	b.u32(0x00480000)
+	b.u32(0)
+	b.u16(1) // frame count
+	b.zeros(32)
+	b.u16(0x0018) // depth
+	b.u16(0xffff)
+
+	var avcC buf
+	avcC.u8(1)
+	avcC.u8(t.sps[1]) // profile
+	avcC.u8(t.sps[2]) // profile compatibility
+	avcC.u8(t.sps[3]) // level
+	avcC.u8(0xff)     // 4 bytes NAL unit length
+	avcC.u8(0xe1)     // 1 SPS
+	avcC.u16(uint16(len(t.sps)))
+	avcC.bytes(t.sps)
+	avcC.u8(1)
+	avcC.u16(uint16(len(t.pps)))
+	avcC.bytes(t.pps)
+
+	return box("avc1", b, box("avcC", avcC))
+}
+
+func mp4aBox(t *track) []byte {
+	var b buf
+	b.zeros(6)
+	b.u16(1) // data reference index
+	b.zeros(8)
+	b.u16(uint16(t.channels))
+	b.u16(16) // sample size
+	b.zeros(4)
+	b.u32(uint32(t.sampleRate) << 16)
+
+	decSpecific := descriptor(0x05, t.asc)
+	var decConfig buf
+	decConfig.u8(0x40) // MPEG-4 audio
+	decConfig.u8(0x15) // audio stream
+	decConfig.bytes([]byte{0, 0, 0})
+	decConfig.u32(0) // max bitrate
+	decConfig.u32(0) // avg bitrate
+	decConfig.bytes(decSpecific)
+
+	var es buf
+	es.u16(uint16(t.id))
+	es.u8(0)
+	es.bytes(descriptor(0x04, decConfig))
+	es.bytes(descriptor(0x06, []byte{0x02}))
+
+	return box("mp4a", b, fullBox("esds", 0, 0, descriptor(0x03, es)))
+}
+
+// descriptor encodes a MPEG-4 elementary stream descriptor.
+func descriptor(tag byte, payload []byte) []byte {
+	n := len(payload)
+	b := buf{tag, 0x80 | byte(n>>21), 0x80 | byte(n>>14), 0x80 | byte(n>>7), byte(n & 0x7f)}
+	return append(b, payload...)
+}
+
+// scale converts v from one timescale to another.
+func scale(v int64, from, to uint32) int64 {
+	return v * int64(to) / int64(from)
+}
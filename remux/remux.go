@@ -0,0 +1,284 @@
+// Package remux converts the H.264/AAC MPEG transport streams served over HLS
+// into progressive MP4 files without re-encoding and without relying on
+// external tools such as ffmpeg.
+package remux
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// ErrNoTracks is returned when the transport stream doesn't contain any
+// supported (H.264 or AAC) elementary stream.
+var ErrNoTracks = errors.New("no H.264 or AAC stream found")
+
+// TsToMp4 remuxes the transport stream at inTsPath into a MP4 file at
+// outMp4Path.
+func TsToMp4(inTsPath, outMp4Path string) error {
+	in, err := os.Open(inTsPath)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(outMp4Path)
+	if err != nil {
+		return err
+	}
+	if err = Remux(in, out); err != nil {
+		out.Close()
+		os.Remove(outMp4Path)
+		return err
+	}
+	return out.Close()
+}
+
+// Remux reads a MPEG transport stream from r and writes it as a MP4 file to
+// w. The moov box is written after the media data so the input is only read
+// once.
+func Remux(r io.Reader, w io.WriteSeeker) error {
+	m, err := newMuxer(w)
+	if err != nil {
+		return err
+	}
+	d := newDemuxer(r)
+	for {
+		p, err := d.next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		switch p.streamType {
+		case streamTypeH264:
+			err = m.writeVideo(p)
+		case streamTypeAAC:
+			err = m.writeAudio(p)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return m.finish()
+}
+
+// muxer writes the samples of the first video and the first audio stream,
+// the other streams, such as alternate audio languages, are dropped.
+type muxer struct {
+	w         *bufio.Writer
+	ws        io.WriteSeeker
+	mdatStart int64
+	offset    int64
+	video     *track
+	audio     *track
+	videoPID  uint16
+	audioPID  uint16
+	last      *track
+}
+
+func newMuxer(w io.WriteSeeker) (*muxer, error) {
+	start, err := w.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, err
+	}
+	m := &muxer{w: bufio.NewWriterSize(w, 1<<20), ws: w}
+	ftyp := ftypBox()
+	// mdat with a 64-bit size so files over 4GB are supported, the size is
+	// patched once all the samples are written.
+	mdat := []byte{0, 0, 0, 1, 'm', 'd', 'a', 't', 0, 0, 0, 0, 0, 0, 0, 0}
+	if _, err := m.w.Write(ftyp); err != nil {
+		return nil, err
+	}
+	if _, err := m.w.Write(mdat); err != nil {
+		return nil, err
+	}
+	m.mdatStart = start + int64(len(ftyp))
+	m.offset = m.mdatStart + int64(len(mdat))
+	return m, nil
+}
+
+func (m *muxer) writeSample(t *track, data []byte, s sample) error {
+	if m.last != t || len(t.chunks) == 0 {
+		t.chunks = append(t.chunks, chunk{offset: m.offset})
+		m.last = t
+	}
+	t.chunks[len(t.chunks)-1].samples++
+	s.size = uint32(len(data))
+	t.samples = append(t.samples, s)
+	n, err := m.w.Write(data)
+	m.offset += int64(n)
+	return err
+}
+
+func (m *muxer) writeVideo(p *pes) error {
+	if p.pts == noTimestamp {
+		return nil
+	}
+	if m.video == nil {
+		m.video = &track{handler: "vide", timescale: videoTimescale}
+		m.videoPID = p.pid
+	}
+	if p.pid != m.videoPID {
+		return nil
+	}
+	t := m.video
+
+	var data buf
+	key := false
+	for _, nal := range splitNALUnits(p.data) {
+		switch nal[0] & 0x1f {
+		case nalSPS:
+			if t.sps == nil {
+				info, err := parseSPS(nal)
+				if err != nil {
+					return fmt.Errorf("failed to parse the SPS - %v", err)
+				}
+				t.sps = append([]byte{}, nal...)
+				t.width, t.height = info.width, info.height
+			}
+			continue
+		case nalPPS:
+			if t.pps == nil {
+				t.pps = append([]byte{}, nal...)
+			}
+			continue
+		case nalAUD:
+			continue
+		case nalIDR:
+			key = true
+		}
+		data.u32(uint32(len(nal)))
+		data.bytes(nal)
+	}
+	if len(data) == 0 {
+		return nil
+	}
+	// frames before the first key frame can't be decoded
+	if len(t.samples) == 0 && (!key || t.sps == nil || t.pps == nil) {
+		return nil
+	}
+	dts := t.unwrap(p.dts)
+	pts := t.unwrap(p.pts)
+	return m.writeSample(t, data, sample{dts: dts, pts: pts, sync: key})
+}
+
+// writeAudio writes the ADTS frames of the packet. The frames are timed by
+// their sample count, the timestamps of the packets are only used to fill
+// the gaps and skip the overlaps of more than a frame.
+func (m *muxer) writeAudio(p *pes) error {
+	if m.audio == nil {
+		m.audio = &track{handler: "soun"}
+		m.audioPID = p.pid
+	}
+	if p.pid != m.audioPID {
+		return nil
+	}
+	t := m.audio
+	pts := int64(noTimestamp)
+	if p.pts != noTimestamp {
+		pts = t.unwrap(p.pts)
+	}
+	// the timestamp is the one of the first frame starting in this packet,
+	// not of the end of a frame started in the previous one
+	carried := len(t.pending)
+	var skip int64
+	data := append(t.pending, p.data...)
+	t.pending = nil
+	for offset := 0; len(data) > 0; {
+		h, err := parseADTSHeader(data)
+		if err == errADTSShort || (err == nil && h.frameLen > len(data)) {
+			// the frame continues in the next PES packet
+			t.pending = append([]byte{}, data...)
+			break
+		}
+		if err != nil {
+			// not a valid header, skip to the next sync word
+			data = data[1:]
+			offset++
+			continue
+		}
+		if t.asc == nil {
+			if pts == noTimestamp {
+				return nil
+			}
+			t.asc = h.audioSpecificConfig()
+			t.sampleRate = h.sampleRate()
+			t.timescale = uint32(t.sampleRate)
+			t.channels = int(h.channelConfig)
+			t.startPTS = pts
+		}
+		if offset >= carried && pts != noTimestamp {
+			frame := scale(aacFrameSamples, t.timescale, videoTimescale)
+			drift := pts - (t.startPTS + scale(t.nextDTS, t.timescale, videoTimescale))
+			switch {
+			case drift < -frame:
+				// the frames overlapping the ones already written are dropped
+				skip = (-drift + frame/2) / frame
+			case drift > frame:
+				// a gap in the stream, the previous frame lasts until this one
+				t.nextDTS += scale(drift, videoTimescale, t.timescale)
+			}
+			pts = noTimestamp
+		}
+		if skip > 0 {
+			skip--
+			data = data[h.frameLen:]
+			offset += h.frameLen
+			continue
+		}
+		ts := t.nextDTS
+		if err := m.writeSample(t, data[h.headerLen:h.frameLen], sample{dts: ts, pts: ts, sync: true}); err != nil {
+			return err
+		}
+		t.nextDTS += aacFrameSamples
+		data = data[h.frameLen:]
+		offset += h.frameLen
+	}
+	return nil
+}
+
+func (m *muxer) finish() error {
+	var tracks []*track
+	start := int64(-1)
+	if m.video != nil && len(m.video.samples) > 0 {
+		minPTS, _ := m.video.mediaStart()
+		start = minPTS
+		tracks = append(tracks, m.video)
+	}
+	if m.audio != nil && len(m.audio.samples) > 0 {
+		if start < 0 || m.audio.startPTS < start {
+			start = m.audio.startPTS
+		}
+		tracks = append(tracks, m.audio)
+	}
+	if len(tracks) == 0 {
+		return ErrNoTracks
+	}
+	for i, t := range tracks {
+		t.id = uint32(i + 1)
+	}
+
+	if _, err := m.w.Write(moovBox(tracks, start)); err != nil {
+		return err
+	}
+	if err := m.w.Flush(); err != nil {
+		return err
+	}
+
+	// patch the mdat size now that we know it
+	mdatSize := m.offset - m.mdatStart
+	size := make(buf, 0, 8)
+	size.u64(uint64(mdatSize))
+	if _, err := m.ws.Seek(m.mdatStart+8, io.SeekStart); err != nil {
+		return err
+	}
+	if _, err := m.ws.Write(size); err != nil {
+		return err
+	}
+	_, err := m.ws.Seek(0, io.SeekEnd)
+	return err
+}
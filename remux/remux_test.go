@@ -0,0 +1,411 @@
+package remux
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// mp4Box is a box found while walking a MP4 file.
+type mp4Box struct {
+	typ  string
+	data []byte // the box content, after its header
+}
+
+// readBoxes splits b into boxes, failing when they don't cover it exactly.
+func readBoxes(t *testing.T, b []byte) []mp4Box {
+	t.Helper()
+	var boxes []mp4Box
+	for len(b) > 0 {
+		if len(b) < 8 {
+			t.Fatalf("truncated box header: % x", b)
+		}
+		size := uint64(binary.BigEndian.Uint32(b))
+		typ := string(b[4:8])
+		headerLen := uint64(8)
+		if size == 1 {
+			size = binary.BigEndian.Uint64(b[8:16])
+			headerLen = 16
+		}
+		if size < headerLen || size > uint64(len(b)) {
+			t.Fatalf("invalid %s box size %d, %d bytes left", typ, size, len(b))
+		}
+		boxes = append(boxes, mp4Box{typ: typ, data: b[headerLen:size]})
+		b = b[size:]
+	}
+	return boxes
+}
+
+// child returns the content of the box found by following the path of box
+// types from b.
+func child(t *testing.T, b []byte, path ...string) []byte {
+	t.Helper()
+	for _, typ := range path {
+		found := false
+		for _, c := range readBoxes(t, b) {
+			if c.typ == typ {
+				b, found = c.data, true
+				break
+			}
+		}
+		if !found {
+			t.Fatalf("missing %s box", typ)
+		}
+	}
+	return b
+}
+
+// memWriteSeeker is an in-memory io.WriteSeeker.
+type memWriteSeeker struct {
+	b   []byte
+	pos int
+}
+
+func (m *memWriteSeeker) Write(p []byte) (int, error) {
+	if need := m.pos + len(p); need > len(m.b) {
+		m.b = append(m.b, make([]byte, need-len(m.b))...)
+	}
+	copy(m.b[m.pos:], p)
+	m.pos += len(p)
+	return len(p), nil
+}
+
+func (m *memWriteSeeker) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case 0:
+		m.pos = int(offset)
+	case 1:
+		m.pos += int(offset)
+	case 2:
+		m.pos = len(m.b) + int(offset)
+	}
+	return int64(m.pos), nil
+}
+
+func TestWriteAudioSkipsCorruptHeaders(t *testing.T) {
+	frame := adtsFrame(1, 4, 2, 20, false)
+	badRate := adtsFrame(1, 15, 2, 20, false)
+	badLen := adtsFrame(1, 4, 2, 0, false)
+	badLen[4], badLen[5] = 0, 3<<5
+
+	tests := []struct {
+		name    string
+		packets [][]byte
+		samples int
+	}{
+		{
+			name:    "invalid sample rate index",
+			packets: [][]byte{append(badRate, bytes.Repeat(frame, 5)...)},
+			samples: 5,
+		},
+		{
+			name:    "frame shorter than its header",
+			packets: [][]byte{append(badLen, bytes.Repeat(frame, 5)...)},
+			samples: 5,
+		},
+		{
+			name:    "corrupt header at the end of a packet",
+			packets: [][]byte{append(bytes.Repeat(frame, 2), badRate[:7]...), bytes.Repeat(frame, 3)},
+			samples: 5,
+		},
+		{
+			name:    "header split across packets",
+			packets: [][]byte{append(bytes.Repeat(frame, 2), frame[:4]...), append(frame[4:], bytes.Repeat(frame, 2)...)},
+			samples: 5,
+		},
+		{
+			name:    "frame split across packets",
+			packets: [][]byte{append(bytes.Repeat(frame, 2), frame[:12]...), append(frame[12:], bytes.Repeat(frame, 2)...)},
+			samples: 5,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := newMuxer(&memWriteSeeker{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i, data := range tt.packets {
+				p := &pes{streamType: streamTypeAAC, pts: int64(i) * 90000, dts: int64(i) * 90000, data: data}
+				if err := m.writeAudio(p); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if n := len(m.audio.samples); n != tt.samples {
+				t.Errorf("expected %d samples, got %d", tt.samples, n)
+			}
+			if len(m.audio.pending) != 0 {
+				t.Errorf("expected no pending data, got %d bytes", len(m.audio.pending))
+			}
+			for i, s := range m.audio.samples {
+				if s.size != 20 {
+					t.Errorf("sample %d: expected 20 bytes, got %d", i, s.size)
+				}
+			}
+		})
+	}
+}
+
+// testStream builds a transport stream carrying frames H.264 frames at 25fps
+// (a key frame every 5 frames) and the matching AAC frames. alternate adds a
+// second video and audio stream with larger samples.
+func testStream(frames int, alternate bool) (ts []byte, audioFrames int) {
+	const (
+		pmtPID     = 0x1000
+		videoPID   = 0x100
+		audioPID   = 0x101
+		videoPID2  = 0x102
+		audioPID2  = 0x103
+		alternateN = 2
+	)
+	streams := map[uint16]byte{videoPID: streamTypeH264, audioPID: streamTypeAAC}
+	order := []uint16{videoPID, audioPID}
+	if alternate {
+		streams[videoPID2], streams[audioPID2] = streamTypeH264, streamTypeAAC
+		order = append(order, videoPID2, audioPID2)
+	}
+	ts = append(ts, tsPackets(0, patPayload(pmtPID))...)
+	ts = append(ts, tsPackets(pmtPID, pmtPayload(videoPID, streams, order))...)
+
+	sps := buildSPS(spsParams{profile: 100, widthMbs: 120, heightMapUnits: 68, frameMbsOnly: true, crop: []int{0, 0, 0, 4}})
+	pps := []byte{0x68, 0xee, 0x3c, 0x80}
+	startCode := []byte{0, 0, 0, 1}
+	const start = 10 * 90000
+	for i := 0; i < frames; i++ {
+		var es []byte
+		es = append(es, startCode...)
+		es = append(es, nalAUD, 0xf0)
+		if i%5 == 0 {
+			es = append(es, startCode...)
+			es = append(es, sps...)
+			es = append(es, startCode...)
+			es = append(es, pps...)
+			es = append(es, startCode...)
+			es = append(es, 0x65)
+		} else {
+			es = append(es, startCode...)
+			es = append(es, 0x41)
+		}
+		es = append(es, bytes.Repeat([]byte{byte(i + 1)}, 300)...)
+		dts := int64(start + i*3600)
+		ts = append(ts, tsPackets(videoPID, pesPacket(0xe0, dts+3600, dts, es))...)
+		if alternate {
+			es = append(es, bytes.Repeat([]byte{0xaa}, 100)...)
+			ts = append(ts, tsPackets(videoPID2, pesPacket(0xe0, dts+3600, dts, es))...)
+		}
+
+		// 48kHz AAC frames last 1920 ticks at 90kHz, two per PES packet
+		if i%2 == 0 {
+			var aac []byte
+			for j := 0; j < 2; j++ {
+				aac = append(aac, adtsFrame(1, 3, 2, 50, false)...)
+			}
+			pts := int64(start + audioFrames*1920)
+			ts = append(ts, tsPackets(audioPID, pesPacket(0xc0, pts, pts, aac))...)
+			if alternate {
+				aac = append(adtsFrame(1, 3, 2, 80, false), adtsFrame(1, 3, 2, 80, false)...)
+				ts = append(ts, tsPackets(audioPID2, pesPacket(0xc0, pts, pts, aac))...)
+			}
+			audioFrames += 2
+		}
+	}
+	return ts, audioFrames
+}
+
+func TestTsToMp4(t *testing.T) {
+	dir, err := ioutil.TempDir("", "remux")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	const frames = 20
+	ts, audioFrames := testStream(frames, false)
+	tsPath := filepath.Join(dir, "in.ts")
+	mp4Path := filepath.Join(dir, "out.mp4")
+	if err := ioutil.WriteFile(tsPath, ts, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := TsToMp4(tsPath, mp4Path); err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(mp4Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	top := readBoxes(t, data)
+	var types []string
+	for _, b := range top {
+		types = append(types, b.typ)
+	}
+	if len(types) != 3 || types[0] != "ftyp" || types[1] != "mdat" || types[2] != "moov" {
+		t.Fatalf("expected ftyp, mdat and moov boxes, got %v", types)
+	}
+
+	var traks [][]byte
+	for _, b := range readBoxes(t, top[2].data) {
+		if b.typ == "trak" {
+			traks = append(traks, b.data)
+		}
+	}
+	if len(traks) != 2 {
+		t.Fatalf("expected 2 tracks, got %d", len(traks))
+	}
+
+	tests := []struct {
+		handler string
+		samples int
+		entry   string
+	}{
+		{"vide", frames, "avc1"},
+		{"soun", audioFrames, "mp4a"},
+	}
+	var mdatSize uint64
+	for i, tt := range tests {
+		trak := traks[i]
+		hdlr := child(t, trak, "mdia", "hdlr")
+		if handler := string(hdlr[8:12]); handler != tt.handler {
+			t.Errorf("track %d: expected a %s handler, got %s", i+1, tt.handler, handler)
+		}
+		stbl := child(t, trak, "mdia", "minf", "stbl")
+		stsd := child(t, stbl, "stsd")
+		if entry := string(stsd[12:16]); entry != tt.entry {
+			t.Errorf("track %d: expected a %s sample entry, got %s", i+1, tt.entry, entry)
+		}
+		stsz := child(t, stbl, "stsz")
+		count := int(binary.BigEndian.Uint32(stsz[8:]))
+		if count != tt.samples {
+			t.Errorf("track %d: expected %d samples, got %d", i+1, tt.samples, count)
+		}
+		for j := 0; j < count; j++ {
+			mdatSize += uint64(binary.BigEndian.Uint32(stsz[12+4*j:]))
+		}
+	}
+	if got := uint64(len(top[1].data)); got != mdatSize {
+		t.Errorf("expected %d bytes of samples in the mdat, got %d", mdatSize, got)
+	}
+
+	tkhd := child(t, traks[0], "tkhd")
+	width := binary.BigEndian.Uint32(tkhd[len(tkhd)-8:]) >> 16
+	height := binary.BigEndian.Uint32(tkhd[len(tkhd)-4:]) >> 16
+	if width != 1920 || height != 1080 {
+		t.Errorf("expected a 1920x1080 video track, got %dx%d", width, height)
+	}
+	stss := child(t, traks[0], "mdia", "minf", "stbl", "stss")
+	if n := binary.BigEndian.Uint32(stss[4:]); n != frames/5 {
+		t.Errorf("expected %d key frames, got %d", frames/5, n)
+	}
+	esds := child(t, traks[1], "mdia", "minf", "stbl", "stsd")
+	if !bytes.Contains(esds, []byte{0x05, 0x80, 0x80, 0x80, 0x02, 0x11, 0x90}) {
+		t.Errorf("expected the 48kHz stereo AudioSpecificConfig in the sample description")
+	}
+}
+
+func TestRemuxNoTracks(t *testing.T) {
+	ts := tsPackets(0, patPayload(0x1000))
+	if err := Remux(bytes.NewReader(ts), &memWriteSeeker{}); err != ErrNoTracks {
+		t.Errorf("expected ErrNoTracks, got %v", err)
+	}
+}
+
+func TestRemuxFirstStreams(t *testing.T) {
+	const frames = 10
+	ts, audioFrames := testStream(frames, true)
+	out := &memWriteSeeker{}
+	if err := Remux(bytes.NewReader(ts), out); err != nil {
+		t.Fatal(err)
+	}
+	top := readBoxes(t, out.b)
+	var sizes [][]uint32
+	for _, b := range readBoxes(t, top[2].data) {
+		if b.typ != "trak" {
+			continue
+		}
+		stsz := child(t, b.data, "mdia", "minf", "stbl", "stsz")
+		var s []uint32
+		for j := 0; j < int(binary.BigEndian.Uint32(stsz[8:])); j++ {
+			s = append(s, binary.BigEndian.Uint32(stsz[12+4*j:]))
+		}
+		sizes = append(sizes, s)
+	}
+	if len(sizes) != 2 {
+		t.Fatalf("expected 2 tracks, got %d", len(sizes))
+	}
+	if len(sizes[0]) != frames || len(sizes[1]) != audioFrames {
+		t.Fatalf("expected %d video and %d audio samples, got %d and %d", frames, audioFrames, len(sizes[0]), len(sizes[1]))
+	}
+	// the samples of the alternate streams are larger
+	for _, size := range sizes[0] {
+		if size > 400 {
+			t.Errorf("expected only the samples of the first video stream, got a %d bytes sample", size)
+		}
+	}
+	for _, size := range sizes[1] {
+		if size != 50 {
+			t.Errorf("expected only the samples of the first audio stream, got a %d bytes sample", size)
+		}
+	}
+}
+
+func TestWriteAudioTimestamps(t *testing.T) {
+	// 48kHz frames last 1920 ticks at 90kHz
+	const frame = 1920
+	packet := append(adtsFrame(1, 3, 2, 20, false), adtsFrame(1, 3, 2, 20, false)...)
+	tests := []struct {
+		name      string
+		pts       []int64
+		durations []uint32
+	}{
+		{
+			name:      "contiguous",
+			pts:       []int64{0, 2 * frame, 4 * frame},
+			durations: []uint32{1024, 1024, 1024, 1024, 1024, 1024},
+		},
+		{
+			name:      "jitter under a frame",
+			pts:       []int64{0, 2*frame + 500, 4*frame - 500},
+			durations: []uint32{1024, 1024, 1024, 1024, 1024, 1024},
+		},
+		{
+			name:      "gap",
+			pts:       []int64{0, 2 * frame, 9 * frame},
+			durations: []uint32{1024, 1024, 1024, 1024 + 5*1024, 1024, 1024},
+		},
+		{
+			name:      "overlap",
+			pts:       []int64{0, 2 * frame, 2 * frame, 4 * frame},
+			durations: []uint32{1024, 1024, 1024, 1024, 1024, 1024},
+		},
+		{
+			name:      "partial overlap",
+			pts:       []int64{0, 2 * frame, 4*frame - frame*7/5},
+			durations: []uint32{1024, 1024, 1024, 1024, 1024},
+		},
+		{
+			name:      "timestamp wrap",
+			pts:       []int64{1<<33 - 2*frame, 0, 2 * frame},
+			durations: []uint32{1024, 1024, 1024, 1024, 1024, 1024},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := newMuxer(&memWriteSeeker{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, pts := range tt.pts {
+				if err := m.writeAudio(&pes{streamType: streamTypeAAC, pts: pts, dts: pts, data: packet}); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if got := m.audio.durations(); !reflect.DeepEqual(got, tt.durations) {
+				t.Errorf("expected durations %v, got %v", tt.durations, got)
+			}
+		})
+	}
+}
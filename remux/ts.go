@@ -0,0 +1,246 @@
+package remux
+
+import (
+	"bufio"
+	"errors"
+	"io"
+)
+
+const (
+	tsPacketSize = 188
+	tsSyncByte   = 0x47
+
+	streamTypeAAC  = 0x0F
+	streamTypeH264 = 0x1B
+
+	// noTimestamp flags a PES packet that didn't carry a PTS or DTS.
+	noTimestamp = -1
+)
+
+// pes is a reassembled packetized elementary stream packet.
+type pes struct {
+	pid        uint16
+	streamType byte
+	pts        int64
+	dts        int64
+	data       []byte
+}
+
+// demuxer extracts the H.264 and AAC elementary streams from a MPEG
+// transport stream.
+type demuxer struct {
+	r       *bufio.Reader
+	pkt     []byte
+	pmtPID  int
+	streams map[uint16]byte
+	buffers map[uint16][]byte
+	// order keeps track of the elementary PIDs so buffers are flushed
+	// deterministically at the end of the stream.
+	order []uint16
+	queue []*pes
+	eof   bool
+}
+
+func newDemuxer(r io.Reader) *demuxer {
+	return &demuxer{
+		r:       bufio.NewReaderSize(r, 64*tsPacketSize),
+		pkt:     make([]byte, tsPacketSize),
+		pmtPID:  -1,
+		streams: map[uint16]byte{},
+		buffers: map[uint16][]byte{},
+	}
+}
+
+// next returns the next complete PES packet of a supported stream.
+// io.EOF is returned once the stream is exhausted.
+func (d *demuxer) next() (*pes, error) {
+	for len(d.queue) == 0 {
+		if d.eof {
+			return nil, io.EOF
+		}
+		if err := d.readPacket(); err != nil {
+			if err != io.EOF && err != io.ErrUnexpectedEOF {
+				return nil, err
+			}
+			d.eof = true
+			for _, pid := range d.order {
+				d.flush(pid)
+			}
+		}
+	}
+	p := d.queue[0]
+	d.queue = d.queue[1:]
+	return p, nil
+}
+
+func (d *demuxer) readPacket() error {
+	// resync on the sync byte in case of garbage between packets
+	for {
+		b, err := d.r.ReadByte()
+		if err != nil {
+			return err
+		}
+		if b == tsSyncByte {
+			d.pkt[0] = b
+			break
+		}
+	}
+	if _, err := io.ReadFull(d.r, d.pkt[1:]); err != nil {
+		return err
+	}
+	pkt := d.pkt
+
+	pusi := pkt[1]&0x40 != 0
+	pid := uint16(pkt[1]&0x1f)<<8 | uint16(pkt[2])
+	afc := (pkt[3] >> 4) & 0x03
+	if afc&0x01 == 0 {
+		// no payload
+		return nil
+	}
+	payload := pkt[4:]
+	if afc&0x02 != 0 {
+		afLen := int(pkt[4])
+		if 5+afLen > tsPacketSize {
+			return nil
+		}
+		payload = pkt[5+afLen:]
+	}
+
+	switch {
+	case pid == 0:
+		if pusi {
+			d.parsePAT(payload)
+		}
+	case int(pid) == d.pmtPID:
+		if pusi {
+			d.parsePMT(payload)
+		}
+	default:
+		if _, ok := d.streams[pid]; !ok {
+			return nil
+		}
+		if pusi {
+			d.flush(pid)
+		} else if d.buffers[pid] == nil {
+			// we joined in the middle of a PES packet
+			return nil
+		}
+		d.buffers[pid] = append(d.buffers[pid], payload...)
+	}
+	return nil
+}
+
+// psiSection strips the pointer field from a PSI payload and returns the
+// section body (after the section length) along with its table id.
+func psiSection(payload []byte) (tableID byte, body []byte, err error) {
+	if len(payload) < 1 {
+		return 0, nil, errors.New("empty PSI payload")
+	}
+	ptr := int(payload[0])
+	payload = payload[1:]
+	if ptr+3 > len(payload) {
+		return 0, nil, errors.New("truncated PSI section")
+	}
+	payload = payload[ptr:]
+	tableID = payload[0]
+	length := int(payload[1]&0x0f)<<8 | int(payload[2])
+	body = payload[3:]
+	if length > len(body) {
+		return 0, nil, errors.New("truncated PSI section")
+	}
+	// drop the CRC32
+	if length < 4 {
+		return 0, nil, errors.New("invalid PSI section length")
+	}
+	return tableID, body[:length-4], nil
+}
+
+func (d *demuxer) parsePAT(payload []byte) {
+	tableID, body, err := psiSection(payload)
+	if err != nil || tableID != 0x00 || len(body) < 5 {
+		return
+	}
+	for entries := body[5:]; len(entries) >= 4; entries = entries[4:] {
+		program := int(entries[0])<<8 | int(entries[1])
+		if program == 0 {
+			// network PID
+			continue
+		}
+		d.pmtPID = int(entries[2]&0x1f)<<8 | int(entries[3])
+		return
+	}
+}
+
+func (d *demuxer) parsePMT(payload []byte) {
+	tableID, body, err := psiSection(payload)
+	if err != nil || tableID != 0x02 || len(body) < 9 {
+		return
+	}
+	infoLen := int(body[7]&0x0f)<<8 | int(body[8])
+	if 9+infoLen > len(body) {
+		return
+	}
+	for es := body[9+infoLen:]; len(es) >= 5; {
+		streamType := es[0]
+		pid := uint16(es[1]&0x1f)<<8 | uint16(es[2])
+		esInfoLen := int(es[3]&0x0f)<<8 | int(es[4])
+		switch streamType {
+		case streamTypeH264, streamTypeAAC:
+			if _, ok := d.streams[pid]; !ok {
+				d.streams[pid] = streamType
+				d.order = append(d.order, pid)
+			}
+		}
+		if 5+esInfoLen > len(es) {
+			return
+		}
+		es = es[5+esInfoLen:]
+	}
+}
+
+// flush parses the buffered PES packet of the passed PID, if any, and
+// queues it.
+func (d *demuxer) flush(pid uint16) {
+	buf := d.buffers[pid]
+	d.buffers[pid] = nil
+	if len(buf) == 0 {
+		return
+	}
+	p, err := parsePES(buf)
+	if err != nil {
+		return
+	}
+	p.pid = pid
+	p.streamType = d.streams[pid]
+	d.queue = append(d.queue, p)
+}
+
+func parsePES(b []byte) (*pes, error) {
+	if len(b) < 9 || b[0] != 0 || b[1] != 0 || b[2] != 1 {
+		return nil, errors.New("invalid PES start code")
+	}
+	p := &pes{pts: noTimestamp, dts: noTimestamp}
+	flags := b[7] >> 6
+	hdrLen := int(b[8])
+	if 9+hdrLen > len(b) {
+		return nil, errors.New("truncated PES header")
+	}
+	if flags&0x02 != 0 && hdrLen >= 5 {
+		p.pts = readTimestamp(b[9:])
+		p.dts = p.pts
+	}
+	if flags == 0x03 && hdrLen >= 10 {
+		p.dts = readTimestamp(b[14:])
+	}
+	p.data = b[9+hdrLen:]
+	return p, nil
+}
+
+// readTimestamp decodes a 33-bit PES timestamp.
+func readTimestamp(b []byte) int64 {
+	return int64(b[0]>>1&0x07)<<30 |
+		int64(b[1])<<22 |
+		int64(b[2]>>1)<<15 |
+		int64(b[3])<<7 |
+		int64(b[4]>>1)
+}
@@ -0,0 +1,210 @@
+package remux
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+// encodeTimestamp encodes a 33-bit PES timestamp with the passed 4-bit
+// prefix and its marker bits.
+func encodeTimestamp(prefix byte, ts int64) []byte {
+	return []byte{
+		prefix<<4 | byte(ts>>29)&0x0e | 1,
+		byte(ts >> 22),
+		byte(ts>>14)&0xfe | 1,
+		byte(ts >> 7),
+		byte(ts<<1) | 1,
+	}
+}
+
+// psi builds a PSI payload: pointer field, table header, body and a CRC32
+// placeholder (the demuxer doesn't check it).
+func psi(tableID byte, body []byte) []byte {
+	length := len(body) + 4
+	b := []byte{0, tableID, 0xb0 | byte(length>>8), byte(length)}
+	b = append(b, body...)
+	return append(b, 0, 0, 0, 0)
+}
+
+func patPayload(pmtPID uint16) []byte {
+	return psi(0x00, []byte{
+		0x00, 0x01, // transport stream id
+		0xc1, 0x00, 0x00, // version, section numbers
+		0x00, 0x01, // program number
+		0xe0 | byte(pmtPID>>8), byte(pmtPID),
+	})
+}
+
+func pmtPayload(pcrPID uint16, streams map[uint16]byte, order []uint16) []byte {
+	body := []byte{
+		0x00, 0x01, // program number
+		0xc1, 0x00, 0x00, // version, section numbers
+		0xe0 | byte(pcrPID>>8), byte(pcrPID),
+		0xf0, 0x00, // program info length
+	}
+	for _, pid := range order {
+		body = append(body, streams[pid], 0xe0|byte(pid>>8), byte(pid), 0xf0, 0x00)
+	}
+	return psi(0x02, body)
+}
+
+// pesPacket builds a PES packet, dts is only written when it differs from
+// pts.
+func pesPacket(streamID byte, pts, dts int64, data []byte) []byte {
+	var hdr []byte
+	switch {
+	case pts == noTimestamp:
+		hdr = []byte{0x80, 0x00, 0x00}
+	case dts == pts:
+		hdr = append([]byte{0x80, 0x80, 5}, encodeTimestamp(0x2, pts)...)
+	default:
+		hdr = append([]byte{0x80, 0xc0, 10}, encodeTimestamp(0x3, pts)...)
+		hdr = append(hdr, encodeTimestamp(0x1, dts)...)
+	}
+	b := []byte{0, 0, 1, streamID, 0, 0}
+	b = append(b, hdr...)
+	return append(b, data...)
+}
+
+// tsPackets splits the payload into transport stream packets, the last one
+// padded with adaptation field stuffing.
+func tsPackets(pid uint16, payload []byte) []byte {
+	var out []byte
+	for first := true; first || len(payload) > 0; first = false {
+		pkt := make([]byte, 4, tsPacketSize)
+		pkt[0] = tsSyncByte
+		pkt[1] = byte(pid>>8) & 0x1f
+		if first {
+			pkt[1] |= 0x40
+		}
+		pkt[2] = byte(pid)
+		pkt[3] = 0x10
+		n := len(payload)
+		if n >= tsPacketSize-4 {
+			n = tsPacketSize - 4
+		} else {
+			pkt[3] = 0x30
+			stuffing := tsPacketSize - 4 - n - 1
+			pkt = append(pkt, byte(stuffing))
+			if stuffing > 0 {
+				pkt = append(pkt, 0x00)
+				pkt = append(pkt, bytes.Repeat([]byte{0xff}, stuffing-1)...)
+			}
+		}
+		out = append(out, pkt...)
+		out = append(out, payload[:n]...)
+		payload = payload[n:]
+	}
+	return out
+}
+
+func TestReadTimestamp(t *testing.T) {
+	for _, ts := range []int64{0, 1, 90000, 1<<30 + 12345, 1<<32 + 1<<15, 1<<33 - 1} {
+		if got := readTimestamp(encodeTimestamp(0x2, ts)); got != ts {
+			t.Errorf("expected %d, got %d", ts, got)
+		}
+	}
+}
+
+func TestPSISection(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload []byte
+		tableID byte
+		body    []byte
+		err     bool
+	}{
+		{
+			name:    "PAT",
+			payload: psi(0x00, []byte{1, 2, 3, 4, 5}),
+			tableID: 0x00,
+			body:    []byte{1, 2, 3, 4, 5},
+		},
+		{
+			name:    "pointer field",
+			payload: append([]byte{2, 0xff, 0xff}, psi(0x02, []byte{9, 8, 7})[1:]...),
+			tableID: 0x02,
+			body:    []byte{9, 8, 7},
+		},
+		{
+			name:    "trailing stuffing",
+			payload: append(psi(0x02, []byte{9, 8, 7}), 0xff, 0xff, 0xff),
+			tableID: 0x02,
+			body:    []byte{9, 8, 7},
+		},
+		{
+			name:    "empty",
+			payload: nil,
+			err:     true,
+		},
+		{
+			name:    "pointer past the end",
+			payload: []byte{10, 0x00, 0xb0},
+			err:     true,
+		},
+		{
+			name:    "truncated body",
+			payload: psi(0x00, []byte{1, 2, 3, 4, 5})[:8],
+			err:     true,
+		},
+		{
+			name:    "length shorter than the CRC",
+			payload: []byte{0, 0x00, 0xb0, 0x02, 0, 0},
+			err:     true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tableID, body, err := psiSection(tt.payload)
+			if (err != nil) != tt.err {
+				t.Fatalf("expected error %v, got %v", tt.err, err)
+			}
+			if err != nil {
+				return
+			}
+			if tableID != tt.tableID || !bytes.Equal(body, tt.body) {
+				t.Errorf("expected table %#x % x, got %#x % x", tt.tableID, tt.body, tableID, body)
+			}
+		})
+	}
+}
+
+func TestDemuxer(t *testing.T) {
+	streams := map[uint16]byte{0x100: streamTypeH264, 0x101: streamTypeAAC}
+	order := []uint16{0x100, 0x101}
+	video := bytes.Repeat([]byte{0xab}, 400)
+	audio := []byte{1, 2, 3}
+
+	var ts []byte
+	ts = append(ts, tsPackets(0, patPayload(0x1000))...)
+	ts = append(ts, tsPackets(0x1000, pmtPayload(0x100, streams, order))...)
+	// a packet of an unknown PID and garbage between packets are skipped
+	ts = append(ts, tsPackets(0x200, []byte{0, 0, 1, 0xbd})...)
+	ts = append(ts, 0x00, 0x11)
+	ts = append(ts, tsPackets(0x100, pesPacket(0xe0, 183000, 180000, video))...)
+	ts = append(ts, tsPackets(0x101, pesPacket(0xc0, 180000, 180000, audio))...)
+
+	d := newDemuxer(bytes.NewReader(ts))
+	var got []*pes
+	for {
+		p, err := d.next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, p)
+	}
+	if len(got) != 2 {
+		t.Fatalf("expected 2 PES packets, got %d", len(got))
+	}
+	v, a := got[0], got[1]
+	if v.pid != 0x100 || v.streamType != streamTypeH264 || v.pts != 183000 || v.dts != 180000 || !bytes.Equal(v.data, video) {
+		t.Errorf("unexpected video packet: pid %#x type %#x pts %d dts %d, %d bytes", v.pid, v.streamType, v.pts, v.dts, len(v.data))
+	}
+	if a.pid != 0x101 || a.streamType != streamTypeAAC || a.pts != 180000 || a.dts != 180000 || !bytes.Equal(a.data, audio) {
+		t.Errorf("unexpected audio packet: pid %#x type %#x pts %d dts %d, % x", a.pid, a.streamType, a.pts, a.dts, a.data)
+	}
+}
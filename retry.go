@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+)
+
+// defaultMaxAttempts is the number of failed attempts after which the retry
+// command gives up on an episode.
+const defaultMaxAttempts = 5
+
+// retryQueue parses the arguments of the retry command and queues the
+// episodes that failed in the previous runs. Their media URL is resolved
+// again when downloading since the signed URLs expire.
+func retryQueue(ctx context.Context, args []string, summary *runSummary) ([]queueItem, error) {
+	fs := flag.NewFlagSet("retry", flag.ExitOnError)
+	maxAttempts := fs.Int("max-attempts", defaultMaxAttempts, "number of failed attempts after which an episode isn't retried anymore")
+	fs.Parse(args)
+	state, err := loadState(".")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the resume state - %v", err)
+	}
+	if len(state.Failed) == 0 {
+		return nil, fmt.Errorf("no failed episode to retry")
+	}
+
+	l := loggerFrom(ctx)
+	var queue []queueItem
+	for i, fj := range state.Failed {
+		summary.listed(fj.Source, 1)
+		report := episodeReport{Title: fj.Title, URL: fj.PageURL, Status: statusFailed}
+		if fj.Attempts >= *maxAttempts {
+			l.Warnf("Giving up on %s after %d attempts - %s", fj.Title, fj.Attempts, fj.Error)
+			summary.record(fj.Source, report, fmt.Errorf("gave up after %d attempts - %s", fj.Attempts, fj.Error))
+			continue
+		}
+		provider, err := providerByName(fj.Provider)
+		if err != nil {
+			summary.record(fj.Source, report, err)
+			continue
+		}
+		l.Debugf("Retrying %s, %d failed attempts so far", fj.Title, fj.Attempts)
+		queue = append(queue, queueItem{
+			Source:   fj.Source,
+			Position: i + 1,
+			Provider: provider,
+			Episode: Episode{
+				Title:         fj.Title,
+				URL:           fj.PageURL,
+				IDMedia:       fj.IDMedia,
+				AppCode:       fj.AppCode,
+				SeasonNumber:  fj.SeasonNumber,
+				EpisodeNumber: fj.EpisodeNumber,
+				Extra:         fj.Extra,
+				Trailer:       fj.Trailer,
+			},
+		})
+	}
+	return queue, nil
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRetryQueueKeepsNames(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cbc-retry")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	episodes := []Episode{
+		{Title: "Bande-annonce (1)", URL: "https://ici.tou.tv/show/bande-annonce", IDMedia: "1", Extra: true, Trailer: true},
+		{Title: "Le retour", URL: "https://ici.tou.tv/show/S02E03", IDMedia: "2", SeasonNumber: 2, EpisodeNumber: 3},
+	}
+	state := &runState{}
+	for _, ep := range episodes {
+		filename, _ := episodePaths(ep)
+		item := queueItem{Source: "https://ici.tou.tv/show", Provider: &touTvProvider{}, Episode: ep}
+		state.recordFailure(item, filename, "", errors.New("timeout"))
+	}
+	if err := state.save("."); err != nil {
+		t.Fatal(err)
+	}
+
+	queue, err := retryQueue(context.Background(), nil, newRunSummary())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(queue) != len(episodes) {
+		t.Fatalf("expected %d episodes to retry, got %d", len(episodes), len(queue))
+	}
+	for i, item := range queue {
+		ep := item.Episode
+		if ep.Extra != episodes[i].Extra || ep.Trailer != episodes[i].Trailer {
+			t.Errorf("expected the extra and trailer flags to be kept, got %+v", ep)
+		}
+		_, want := episodePaths(episodes[i])
+		if _, path := episodePaths(ep); path != want {
+			t.Errorf("expected the retried episode to be saved as %s, got %s", want, path)
+		}
+	}
+	if _, path := episodePaths(queue[0].Episode); filepath.Dir(path) != extrasDir {
+		t.Errorf("expected the extra to be saved in %s, got %s", extrasDir, path)
+	}
+	if _, path := episodePaths(queue[1].Episode); path != "S02E03 - Le retour.mp4" {
+		t.Errorf("expected the code in the file name, got %s", path)
+	}
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/runes"
+	"golang.org/x/text/transform"
+	"golang.org/x/text/unicode/norm"
+)
+
+// longestSuffix is the longest suffix appended to an episode name, the names
+// are truncated so the files still fit in the byte limit with it.
+const longestSuffix = ".mp4" + partSuffix
+
+// fsProfile describes the file names accepted by a target filesystem.
+type fsProfile struct {
+	// replacements maps the reserved characters to their replacement, an
+	// empty string drops the character.
+	replacements map[rune]string
+	// trimTrailing is the set of characters not allowed at the end of a
+	// name.
+	trimTrailing string
+	// reservedNames are names that can't be used, whatever the extension.
+	reservedNames []string
+	// caseInsensitive filesystems consider names differing only by case to
+	// be the same.
+	caseInsensitive bool
+	maxBytes        int
+}
+
+var windowsReplacements = map[rune]string{
+	'/': "-", '\\': "-", '|': "-", ':': "", '*': "", '?': "", '"': "'", '<': "", '>': "",
+}
+
+var windowsReservedNames = []string{
+	"CON", "PRN", "AUX", "NUL",
+	"COM1", "COM2", "COM3", "COM4", "COM5", "COM6", "COM7", "COM8", "COM9",
+	"LPT1", "LPT2", "LPT3", "LPT4", "LPT5", "LPT6", "LPT7", "LPT8", "LPT9",
+}
+
+// fsProfiles are the supported target filesystems. The windows profile
+// produces names valid everywhere, including on the NAS (SMB) shares.
+var fsProfiles = map[string]*fsProfile{
+	"windows": {
+		replacements:    windowsReplacements,
+		trimTrailing:    ". ",
+		reservedNames:   windowsReservedNames,
+		caseInsensitive: true,
+		maxBytes:        255,
+	},
+	"macos": {
+		replacements:    map[rune]string{'/': "-", ':': ""},
+		caseInsensitive: true,
+		maxBytes:        255,
+	},
+	"linux": {
+		replacements: map[rune]string{'/': "-"},
+		maxBytes:     255,
+	},
+}
+
+// ligatures are the letters transliterated to several ASCII letters.
+var ligatures = strings.NewReplacer("œ", "oe", "Œ", "OE", "æ", "ae", "Æ", "AE", "ß", "ss")
+
+// filenameSanitizer turns titles into file names valid on the target
+// filesystem. The names only depend on the titles: when cleaning changes a
+// title, a short hash of the title is appended so it can't end up with the
+// name of another title, in this run or in the previous ones.
+type filenameSanitizer struct {
+	profile       *fsProfile
+	transliterate bool
+}
+
+func newFilenameSanitizer(profile string, transliterate bool) (*filenameSanitizer, error) {
+	p, ok := fsProfiles[profile]
+	if !ok {
+		return nil, fmt.Errorf("unknown filesystem profile %q, use windows, macos or linux", profile)
+	}
+	return &filenameSanitizer{
+		profile:       p,
+		transliterate: transliterate,
+	}, nil
+}
+
+// filenames is the sanitizer used for the run, configured from the flags.
+var filenames, _ = newFilenameSanitizer("windows", false)
+
+// episodeName returns the file name, without extension, of the episode with
+// the passed title. The same title always gets the same name.
+func (s *filenameSanitizer) episodeName(title string) string {
+	// differences in whitespace don't make different titles
+	title = strings.Join(strings.Fields(norm.NFC.String(title)), " ")
+	limit := s.profile.maxBytes - len(longestSuffix)
+	name := s.clean(title, "", limit)
+	if name != title {
+		sum := sha1.Sum([]byte(title))
+		tag := " [" + hex.EncodeToString(sum[:4]) + "]"
+		name = s.clean(title, "", limit-len(tag)) + tag
+	}
+	return name
+}
+
+// cleanPath sanitizes each element of the path, the root of an absolute
+// path is kept as is.
+func (s *filenameSanitizer) cleanPath(path string) string {
+	if path == "" {
+		return "."
+	}
+	parts := strings.Split(filepath.ToSlash(filepath.Clean(path)), "/")
+	for i, part := range parts {
+		if part != "." && part != ".." && (i > 0 || !filepath.IsAbs(path)) {
+			parts[i] = s.clean(part, "", s.profile.maxBytes)
+		}
+	}
+	return filepath.FromSlash(strings.Join(parts, "/"))
+}
+
+func (s *filenameSanitizer) clean(name, ext string, limit int) string {
+	name = norm.NFC.String(name)
+	if s.transliterate {
+		name = toASCII(name)
+	}
+
+	var b strings.Builder
+	space := false
+	for _, r := range name {
+		if repl, ok := s.profile.replacements[r]; ok {
+			if repl != "" {
+				b.WriteString(repl)
+				space = false
+			}
+			continue
+		}
+		switch {
+		case unicode.IsSpace(r):
+			// collapse the whitespace, including tabs and new lines
+			if !space {
+				b.WriteRune(' ')
+			}
+			space = true
+			continue
+		case unicode.IsControl(r), unicode.Is(unicode.Cf, r), r == utf8.RuneError:
+			continue
+		}
+		b.WriteRune(r)
+		space = false
+	}
+	name = strings.TrimLeft(strings.TrimSpace(b.String()), ".")
+	name = truncateUTF8(name, limit-len(ext))
+	name = strings.TrimRight(name, " "+s.profile.trimTrailing)
+	if name == "" {
+		name = "untitled"
+	}
+	base := strings.ToUpper(name)
+	if idx := strings.IndexByte(base, '.'); idx >= 0 {
+		base = base[:idx]
+	}
+	for _, reserved := range s.profile.reservedNames {
+		if base == reserved {
+			name = "_" + name
+			break
+		}
+	}
+	return name + ext
+}
+
+// nameKey returns the key of the episode name of the title, titles with the
+// same key would end up in the same file.
+func (s *filenameSanitizer) nameKey(title string) string {
+	return s.key(s.episodeName(title))
+}
+
+// key is the name as compared by the filesystem.
+func (s *filenameSanitizer) key(name string) string {
+	if s.profile.caseInsensitive {
+		return strings.ToLower(name)
+	}
+	return name
+}
+
+// toASCII removes the accents and transliterates the ligatures, the other
+// non ASCII characters such as emoji are dropped.
+func toASCII(s string) string {
+	t := transform.Chain(norm.NFD, runes.Remove(runes.In(unicode.Mn)), norm.NFC)
+	if stripped, _, err := transform.String(t, s); err == nil {
+		s = stripped
+	}
+	s = ligatures.Replace(s)
+	return strings.Map(func(r rune) rune {
+		if r > unicode.MaxASCII {
+			return -1
+		}
+		return r
+	}, s)
+}
+
+// truncateUTF8 truncates s to at most n bytes without cutting a character.
+func truncateUTF8(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	if n < 0 {
+		n = 0
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func mustSanitizer(t *testing.T, profile string, transliterate bool) *filenameSanitizer {
+	t.Helper()
+	s, err := newFilenameSanitizer(profile, transliterate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestNewFilenameSanitizer(t *testing.T) {
+	for _, profile := range []string{"windows", "macos", "linux"} {
+		if _, err := newFilenameSanitizer(profile, false); err != nil {
+			t.Errorf("%s: %v", profile, err)
+		}
+	}
+	if _, err := newFilenameSanitizer("fat32", false); err == nil {
+		t.Error("expected an error for an unknown profile")
+	}
+}
+
+func TestSanitizerClean(t *testing.T) {
+	tests := []struct {
+		profile       string
+		transliterate bool
+		in, want      string
+	}{
+		{"windows", false, "L'été de Léa", "L'été de Léa"},
+		{"windows", false, `Qui a dit "non"?`, "Qui a dit 'non'"},
+		{"windows", false, "Tom & Jerry: le film", "Tom & Jerry le film"},
+		{"windows", false, "A/B\\C|D", "A-B-C-D"},
+		{"windows", false, "<*étoile*>", "étoile"},
+		{"windows", false, "Fin...", "Fin"},
+		{"windows", false, "Suite. ", "Suite"},
+		{"windows", false, ".cache", "cache"},
+		{"windows", false, "  tab\there\nnewline  ", "tab here newline"},
+		{"windows", false, "zero\u200bwidth\x00", "zerowidth"},
+		{"windows", false, "CON", "_CON"},
+		{"windows", false, "com1.txt", "_com1.txt"},
+		{"windows", false, "CONSOLE", "CONSOLE"},
+		{"windows", false, "???", "untitled"},
+		{"windows", false, "Bonjour!", "Bonjour!"},
+		{"macos", false, `Qui? "Moi": oui/non`, `Qui? "Moi" oui-non`},
+		{"macos", false, "CON", "CON"},
+		{"linux", false, `a:b*c?"d"/e`, `a:b*c?"d"-e`},
+		{"linux", false, "Fin...", "Fin..."},
+		{"windows", true, "L'été de Léa", "L'ete de Lea"},
+		{"windows", true, "Cœur ÆSOP straße", "Coeur AESOP strasse"},
+		{"windows", true, "Fête 🎉 party", "Fete party"},
+		// decomposed accents are composed
+		{"linux", false, "e\u0301te\u0301", "\u00e9t\u00e9"},
+	}
+	for _, tt := range tests {
+		s := mustSanitizer(t, tt.profile, tt.transliterate)
+		if got := s.clean(tt.in, "", 255); got != tt.want {
+			t.Errorf("%s (transliterate %v) %q: expected %q, got %q", tt.profile, tt.transliterate, tt.in, tt.want, got)
+		}
+	}
+}
+
+func TestSanitizerTruncation(t *testing.T) {
+	s := mustSanitizer(t, "linux", false)
+	tests := []struct {
+		in    string
+		ext   string
+		limit int
+		want  string
+	}{
+		{"abcdef", ".mp4", 8, "abcd.mp4"},
+		{"abc", ".mp4", 8, "abc.mp4"},
+		// é is 2 bytes, it isn't cut in half
+		{"ééé", "", 5, "éé"},
+		{"aéé", "", 4, "aé"},
+		// the trailing spaces left by the truncation are trimmed
+		{"ab cd", "", 3, "ab"},
+	}
+	for _, tt := range tests {
+		if got := s.clean(tt.in, tt.ext, tt.limit); got != tt.want {
+			t.Errorf("%q %d: expected %q, got %q", tt.in, tt.limit, tt.want, got)
+		}
+	}
+
+	long := strings.Repeat("é", 300)
+	for _, profile := range []string{"windows", "macos", "linux"} {
+		name := mustSanitizer(t, profile, false).episodeName(long) + longestSuffix
+		if len(name) > 255 || !utf8.ValidString(name) {
+			t.Errorf("%s: expected a valid name of at most 255 bytes, got %d bytes", profile, len(name))
+		}
+	}
+}
+
+var hashTag = regexp.MustCompile(` \[[0-9a-f]{8}\]$`)
+
+func TestEpisodeName(t *testing.T) {
+	s := mustSanitizer(t, "windows", false)
+	tests := []struct {
+		title  string
+		hashed bool
+	}{
+		{"Épisode 1", false},
+		{"L'été  de   Léa", false},
+		{" Espaces ", false},
+		{"Foo?", true},
+		{"Qui: moi", true},
+		{"CON", true},
+		{strings.Repeat("a", 300), true},
+	}
+	for _, tt := range tests {
+		name := s.episodeName(tt.title)
+		if hashTag.MatchString(name) != tt.hashed {
+			t.Errorf("%q: expected hashed %v, got %q", tt.title, tt.hashed, name)
+		}
+		if again := s.episodeName(tt.title); again != name {
+			t.Errorf("%q: got %q then %q", tt.title, name, again)
+		}
+	}
+	if name := s.episodeName("L'été  de\tLéa "); name != "L'été de Léa" {
+		t.Errorf("expected the whitespace to be normalised, got %q", name)
+	}
+	// a decomposed title is the same title
+	if a, b := s.episodeName("\u00e9t\u00e9"), s.episodeName("e\u0301te\u0301"); a != b {
+		t.Errorf("expected the same name for both forms, got %q and %q", a, b)
+	}
+}
+
+func TestEpisodeNameNeverCollides(t *testing.T) {
+	titles := []string{
+		"Foo", "Foo?", "Foo*", "Foo:", "<Foo>",
+		"A/B", "A-B", "A|B",
+		strings.Repeat("x", 300) + "1", strings.Repeat("x", 300) + "2",
+	}
+	for _, profile := range []string{"windows", "macos", "linux"} {
+		for _, transliterate := range []bool{false, true} {
+			seen := map[string]string{}
+			// every title is named by a fresh sanitizer, like separate runs
+			for _, title := range titles {
+				s := mustSanitizer(t, profile, transliterate)
+				key := s.nameKey(title)
+				if other, ok := seen[key]; ok {
+					t.Errorf("%s (transliterate %v): %q and %q both named %q", profile, transliterate, other, title, s.episodeName(title))
+				}
+				seen[key] = title
+			}
+		}
+	}
+	s := mustSanitizer(t, "windows", true)
+	if a, b := s.episodeName("Été"), s.episodeName("Ete"); a == b {
+		t.Errorf("expected different names for Été and Ete, got %q", a)
+	}
+}
+
+func TestCleanPath(t *testing.T) {
+	s := mustSanitizer(t, "windows", false)
+	tests := []struct {
+		in, want string
+	}{
+		{"", "."},
+		{"Émissions/Qui?/Saison 1", filepath.Join("Émissions", "Qui", "Saison 1")},
+		{"../shows/", filepath.Join("..", "shows")},
+		{"/data/Fin.../x", filepath.FromSlash("/data/Fin/x")},
+	}
+	for _, tt := range tests {
+		if got := s.cleanPath(tt.in); got != tt.want {
+			t.Errorf("%q: expected %q, got %q", tt.in, tt.want, got)
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+)
+
+// notifyContext returns a context canceled when an interrupt or termination
+// signal is received, and a function returning that signal (nil if none was
+// received). A second signal exits right away.
+func notifyContext() (context.Context, func() os.Signal) {
+	ctx, cancel := context.WithCancel(context.Background())
+	sigs := make(chan os.Signal, 2)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+
+	var mu sync.Mutex
+	var received os.Signal
+	go func() {
+		sig := <-sigs
+		mu.Lock()
+		received = sig
+		mu.Unlock()
+		loggerFrom(ctx).Warnf("%v received, stopping (send it again to quit immediately)", sig)
+		cancel()
+		sig = <-sigs
+		os.Exit(exitCode(sig))
+	}()
+
+	return ctx, func() os.Signal {
+		mu.Lock()
+		defer mu.Unlock()
+		return received
+	}
+}
+
+// exitCode follows the shell convention of exiting with 128 + the signal
+// number.
+func exitCode(sig os.Signal) int {
+	if s, ok := sig.(syscall.Signal); ok {
+		return 128 + int(s)
+	}
+	return 1
+}
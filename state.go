@@ -0,0 +1,172 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// stateFilename is the name of the file, in the destination folder, keeping
+// track of the episodes that need to be resumed or retried.
+const stateFilename = ".cbc-state.json"
+
+// runState is persisted between runs so interrupted downloads can be
+// resumed and failed ones retried.
+type runState struct {
+	Interrupted []*jobState  `json:"interrupted,omitempty"`
+	Failed      []*failedJob `json:"failed,omitempty"`
+}
+
+// jobState describes an episode that didn't complete.
+type jobState struct {
+	Title    string `json:"title"`
+	PageURL  string `json:"pageUrl"`
+	Filename string `json:"filename"`
+	DestPath string `json:"destPath"`
+	// TsPath is set once all the segments were assembled, only the
+	// conversion is left to do.
+	TsPath     string    `json:"tsPath,omitempty"`
+	Segments   int       `json:"segments"`
+	Downloaded int       `json:"downloadedSegments"`
+	UpdatedAt  time.Time `json:"updatedAt"`
+}
+
+// failedJob describes an episode that failed, with what is needed to
+// resolve it again.
+type failedJob struct {
+	Title    string `json:"title"`
+	PageURL  string `json:"pageUrl"`
+	Filename string `json:"filename"`
+	// Source is the show URL or media id the episode was listed from.
+	Source   string `json:"source"`
+	Provider string `json:"provider"`
+	IDMedia  string `json:"idMedia,omitempty"`
+	AppCode  string `json:"appCode,omitempty"`
+	// The numbers, Extra and Trailer are kept so a retried episode is saved
+	// under the same name and a retried extra in the Extras folder.
+	SeasonNumber  int  `json:"seasonNumber,omitempty"`
+	EpisodeNumber int  `json:"episodeNumber,omitempty"`
+	Extra         bool `json:"extra,omitempty"`
+	Trailer       bool `json:"trailer,omitempty"`
+	// MediaURL is the last resolved URL, kept for reference only since the
+	// signed URLs expire.
+	MediaURL string    `json:"mediaUrl,omitempty"`
+	Error    string    `json:"error"`
+	Attempts int       `json:"attempts"`
+	FailedAt time.Time `json:"failedAt"`
+}
+
+// loadState reads the state file in dir, an empty state is returned if
+// there isn't any.
+func loadState(dir string) (*runState, error) {
+	s := &runState{}
+	data, err := ioutil.ReadFile(filepath.Join(dir, stateFilename))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return s, nil
+		}
+		return nil, err
+	}
+	if err = json.Unmarshal(data, s); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// save writes the state file in dir, or removes it if there is nothing left
+// to keep track of.
+func (s *runState) save(dir string) error {
+	path := filepath.Join(dir, stateFilename)
+	if len(s.Interrupted) == 0 && len(s.Failed) == 0 {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err = ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// interrupted returns the state of the interrupted episode saved under the
+// passed filename, if any.
+func (s *runState) interrupted(filename string) *jobState {
+	for _, js := range s.Interrupted {
+		if js.Filename == filename {
+			return js
+		}
+	}
+	return nil
+}
+
+// setInterrupted records the state of an interrupted episode.
+func (s *runState) setInterrupted(js *jobState) {
+	js.UpdatedAt = time.Now()
+	s.forget(js.Filename)
+	s.Interrupted = append(s.Interrupted, js)
+}
+
+// recordFailure records a failed attempt at downloading the episode, the
+// attempts are counted across runs.
+func (s *runState) recordFailure(item queueItem, filename, mediaURL string, err error) {
+	fj := s.failure(filename)
+	if fj == nil {
+		fj = &failedJob{Filename: filename}
+		s.Failed = append(s.Failed, fj)
+	}
+	fj.Title = item.Episode.Title
+	fj.PageURL = item.Episode.URL
+	fj.Source = item.Source
+	fj.Provider = item.Provider.Name()
+	fj.IDMedia = item.Episode.IDMedia
+	fj.AppCode = item.Episode.AppCode
+	fj.SeasonNumber = item.Episode.SeasonNumber
+	fj.EpisodeNumber = item.Episode.EpisodeNumber
+	fj.Extra = item.Episode.Extra
+	fj.Trailer = item.Episode.Trailer
+	fj.MediaURL = mediaURL
+	fj.Error = err.Error()
+	fj.Attempts++
+	fj.FailedAt = time.Now()
+}
+
+// failure returns the failed episode saved under the passed filename, if
+// any.
+func (s *runState) failure(filename string) *failedJob {
+	for _, fj := range s.Failed {
+		if fj.Filename == filename {
+			return fj
+		}
+	}
+	return nil
+}
+
+// forgetFailure removes the episode from the failed ones.
+func (s *runState) forgetFailure(filename string) {
+	kept := s.Failed[:0]
+	for _, fj := range s.Failed {
+		if fj.Filename != filename {
+			kept = append(kept, fj)
+		}
+	}
+	s.Failed = kept
+}
+
+// forget removes the episode from the interrupted ones.
+func (s *runState) forget(filename string) {
+	kept := s.Interrupted[:0]
+	for _, js := range s.Interrupted {
+		if js.Filename != filename {
+			kept = append(kept, js)
+		}
+	}
+	s.Interrupted = kept
+}
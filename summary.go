@@ -0,0 +1,237 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"time"
+)
+
+// episodeStatus is the outcome of an episode download.
+type episodeStatus int
+
+const (
+	statusDownloaded episodeStatus = iota
+	statusSkipped
+	statusFailed
+	statusUnavailable
+	// numStatuses is the number of statuses, not a status.
+	numStatuses
+)
+
+var statusNames = []string{"downloaded", "skipped", "failed", "unavailable"}
+
+func (st episodeStatus) String() string {
+	return statusNames[st]
+}
+
+func (st episodeStatus) MarshalJSON() ([]byte, error) {
+	return json.Marshal(st.String())
+}
+
+// Exit codes of a run, the interrupted runs exit with 128 + the signal
+// number.
+const (
+	exitOK = 0
+	// exitFatal is used when the run couldn't start, for instance because
+	// of invalid flags.
+	exitFatal = 1
+	// exitPartialFailure means some episodes or sources failed while others
+	// were downloaded or skipped.
+	exitPartialFailure = 2
+	// exitTotalFailure means nothing was downloaded or skipped because
+	// everything failed.
+	exitTotalFailure = 3
+)
+
+// runSummary collects the outcome of every source and episode of a run.
+type runSummary struct {
+	start   time.Time
+	sources []*sourceSummary
+}
+
+type sourceSummary struct {
+	source     string
+	episodes   int
+	listingErr error
+	counts     [numStatuses]int
+	reports    []episodeReport
+}
+
+// episodeReport is the outcome of an episode.
+type episodeReport struct {
+	Title  string        `json:"title"`
+	URL    string        `json:"url,omitempty"`
+	Status episodeStatus `json:"status"`
+	Reason string        `json:"reason,omitempty"`
+	Path   string        `json:"path,omitempty"`
+	Bytes  int64         `json:"bytes,omitempty"`
+	Rating string        `json:"rating,omitempty"`
+	Tags   []Tag         `json:"tags,omitempty"`
+}
+
+func newRunSummary() *runSummary {
+	return &runSummary{start: time.Now()}
+}
+
+func (s *runSummary) get(source string) *sourceSummary {
+	for _, ss := range s.sources {
+		if ss.source == source {
+			return ss
+		}
+	}
+	ss := &sourceSummary{source: source}
+	s.sources = append(s.sources, ss)
+	return ss
+}
+
+func (s *runSummary) listed(source string, episodes int) {
+	s.get(source).episodes += episodes
+}
+
+func (s *runSummary) listingFailed(source string, err error) {
+	s.get(source).listingErr = err
+}
+
+// deselect removes the queued episodes that weren't picked from the counts.
+func (s *runSummary) deselect(queue, picked []queueItem) {
+	for _, item := range queue {
+		s.get(item.Source).episodes--
+	}
+	for _, item := range picked {
+		s.get(item.Source).episodes++
+	}
+}
+
+// record adds the outcome of an episode, err is the reason of a failure.
+func (s *runSummary) record(source string, r episodeReport, err error) {
+	if err != nil {
+		r.Reason = err.Error()
+	}
+	ss := s.get(source)
+	ss.counts[r.Status]++
+	ss.reports = append(ss.reports, r)
+}
+
+func (s *runSummary) totals() (counts [numStatuses]int, bytes int64, failedSources int) {
+	for _, ss := range s.sources {
+		if ss.listingErr != nil {
+			failedSources++
+		}
+		for i, n := range ss.counts {
+			counts[i] += n
+		}
+		for _, r := range ss.reports {
+			bytes += r.Bytes
+		}
+	}
+	return counts, bytes, failedSources
+}
+
+// exitCode tells a full success from a partial or a total failure. The
+// unavailable episodes aren't failures, they can't be downloaded at all.
+func (s *runSummary) exitCode() int {
+	counts, _, failedSources := s.totals()
+	failures := counts[statusFailed] + failedSources
+	switch {
+	case failures == 0:
+		return exitOK
+	case counts[statusDownloaded]+counts[statusSkipped] == 0:
+		return exitTotalFailure
+	}
+	return exitPartialFailure
+}
+
+// listingExitCode is the exit code of a run which only lists the episodes,
+// such as -list and -dry-run, based on the sources that couldn't be listed.
+func (s *runSummary) listingExitCode() int {
+	_, _, failedSources := s.totals()
+	switch {
+	case failedSources == 0:
+		return exitOK
+	case failedSources == len(s.sources):
+		return exitTotalFailure
+	}
+	return exitPartialFailure
+}
+
+// print writes the outcome of each episode by source followed by the totals.
+func (s *runSummary) print(w io.Writer) {
+	fmt.Fprintln(w, "Summary:")
+	for _, ss := range s.sources {
+		if ss.listingErr != nil {
+			fmt.Fprintf(w, "  %s: listing failed - %v\n", ss.source, ss.listingErr)
+			continue
+		}
+		fmt.Fprintf(w, "  %s: %d episodes, %s\n", ss.source, ss.episodes, formatCounts(ss.counts))
+		for _, r := range ss.reports {
+			line := fmt.Sprintf("    %-11s %s", r.Status, r.Title)
+			if r.Bytes > 0 {
+				line += " (" + formatBytes(r.Bytes) + ")"
+			}
+			if r.Reason != "" {
+				line += " - " + r.Reason
+			}
+			fmt.Fprintln(w, line)
+		}
+	}
+	counts, bytes, failedSources := s.totals()
+	fmt.Fprintf(w, "Total: %s", formatCounts(counts))
+	if failedSources > 0 {
+		fmt.Fprintf(w, ", %d sources couldn't be listed", failedSources)
+	}
+	fmt.Fprintf(w, " | %s in %s\n", formatBytes(bytes), time.Since(s.start).Round(time.Second))
+}
+
+func formatCounts(counts [numStatuses]int) string {
+	return fmt.Sprintf("%d downloaded, %d skipped, %d failed, %d unavailable",
+		counts[statusDownloaded], counts[statusSkipped], counts[statusFailed], counts[statusUnavailable])
+}
+
+// summaryJSON is the JSON report of a run.
+type summaryJSON struct {
+	Start    time.Time           `json:"start"`
+	Elapsed  float64             `json:"elapsedSeconds"`
+	Bytes    int64               `json:"bytes"`
+	Counts   map[string]int      `json:"counts"`
+	ExitCode int                 `json:"exitCode"`
+	Sources  []sourceSummaryJSON `json:"sources"`
+}
+
+type sourceSummaryJSON struct {
+	Source       string          `json:"source"`
+	ListingError string          `json:"listingError,omitempty"`
+	Episodes     []episodeReport `json:"episodes"`
+}
+
+// writeJSON writes the report as JSON to the file at path.
+func (s *runSummary) writeJSON(path string, exitCode int) error {
+	counts, bytes, failedSources := s.totals()
+	report := summaryJSON{
+		Start:    s.start,
+		Elapsed:  time.Since(s.start).Seconds(),
+		Bytes:    bytes,
+		Counts:   map[string]int{"failedSources": failedSources},
+		ExitCode: exitCode,
+		Sources:  []sourceSummaryJSON{},
+	}
+	for i, n := range counts {
+		report.Counts[statusNames[i]] = n
+	}
+	for _, ss := range s.sources {
+		sj := sourceSummaryJSON{Source: ss.source, Episodes: ss.reports}
+		if ss.listingErr != nil {
+			sj.ListingError = ss.listingErr.Error()
+		}
+		if sj.Episodes == nil {
+			sj.Episodes = []episodeReport{}
+		}
+		report.Sources = append(report.Sources, sj)
+	}
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, append(data, '\n'), 0644)
+}
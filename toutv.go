@@ -0,0 +1,518 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	presentationURL = "https://ici.tou.tv/presentation/"
+)
+
+func init() {
+	registerProvider(&touTvProvider{})
+}
+
+// touTvProvider handles the ici.tou.tv shows using the presentation API.
+type touTvProvider struct{}
+
+func (p *touTvProvider) Name() string {
+	return "tou.tv"
+}
+
+func (p *touTvProvider) Match(u *url.URL) bool {
+	return u.Host == "tou.tv" || strings.HasSuffix(u.Host, ".tou.tv")
+}
+
+// ListShow lists the episodes of every season lineup of the show, the videos
+// of the other lineups belonging to the show are listed as extras. The
+// presentation only comes with the episodes of the selected season, the
+// other seasons are fetched separately.
+func (p *touTvProvider) ListShow(ctx context.Context, u *url.URL) (*Show, error) {
+	showKey := strings.Split(strings.Trim(u.Path, "/"), "/")[0]
+	if showKey == "" {
+		return nil, fmt.Errorf("no show found in %s", u)
+	}
+	data, err := p.presentation(ctx, showKey)
+	if err != nil {
+		return nil, err
+	}
+
+	show := &Show{
+		ID:          showKey,
+		Title:       data.Title,
+		URL:         p.itemURL(showKey),
+		Description: data.Description,
+		ImageURL:    data.ImageURL,
+	}
+	listed := listedItems{}
+	for _, lineup := range data.SeasonLineups {
+		number := seasonNumber(lineup.Name, lineup.Title)
+		items := lineup.LineupItems
+		if len(items) == 0 && number > 0 {
+			loggerFrom(ctx).Debugf("Fetching the episodes of %s", lineup.Title)
+			if items, err = p.seasonItems(ctx, showKey, lineup, number); err != nil {
+				return nil, fmt.Errorf("failed to list %s - %v", lineup.Title, err)
+			}
+		}
+		if len(items) > 0 {
+			show.season(number).Title = lineup.Title
+		}
+		for _, item := range items {
+			if item.IDMedia == "" && item.URL == "" {
+				loggerFrom(ctx).Debugf("Skipping %q of %s, it has neither a media nor a page", item.Title, lineup.Title)
+				continue
+			}
+			if !listed.add(item) {
+				continue
+			}
+			// the media of the items without one is looked up when resolving
+			ep := p.episode(item)
+			if ep.SeasonNumber == 0 {
+				ep.SeasonNumber = number
+			}
+			show.add(ep)
+		}
+	}
+	for _, lineup := range data.OtherLineups {
+		for _, item := range lineup.LineupItems {
+			// the related shows are listed in other lineups too
+			if !p.isShowItem(showKey, item.URL) || !listed.add(item) {
+				continue
+			}
+			ep := p.episode(item)
+			ep.Extra = true
+			ep.Trailer = isTrailer(lineup.Name, lineup.Title, item.Title)
+			// the other lineups don't flag the availability, the media is
+			// looked up when resolving
+			ep.Unavailable = false
+			show.add(ep)
+		}
+	}
+	return show, nil
+}
+
+// seasonItems fetches the presentation of a season which wasn't selected and
+// returns the items of its lineup.
+func (p *touTvProvider) seasonItems(ctx context.Context, showKey string, lineup PresentationLineup, number int) ([]PresentationItem, error) {
+	key := fmt.Sprintf("%s/S%02d", showKey, number)
+	if s, ok := lineup.URL.(string); ok && s != "" {
+		if u, err := url.Parse(p.itemURL(s)); err == nil {
+			key = strings.Trim(u.Path, "/")
+		}
+	}
+	data, err := p.presentation(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	for _, l := range data.SeasonLineups {
+		if seasonNumber(l.Name, l.Title) == number && len(l.LineupItems) > 0 {
+			return l.LineupItems, nil
+		}
+	}
+	return nil, fmt.Errorf("no episodes found in %s", key)
+}
+
+var (
+	// seasonPattern matches the season number in the names and titles of
+	// the lineups, for instance "Saison 2" or "S02".
+	seasonPattern = regexp.MustCompile(`(?i)(?:saison|season|^s)[\s_-]*0*(\d+)`)
+	// episodeKeyPattern matches the season and episode numbers in the item
+	// URLs, for instance /show/S02E03.
+	episodeKeyPattern = regexp.MustCompile(`(?i)/S(\d+)E(\d+)(?:/|$)`)
+	// episodeTitlePattern matches the episode number in a title.
+	episodeTitlePattern = regexp.MustCompile(`(?i)(?:épisode|episode)\s*0*(\d+)`)
+)
+
+// seasonNumber returns the number of a season lineup, 0 when it isn't one.
+func seasonNumber(names ...string) int {
+	for _, name := range names {
+		if m := seasonPattern.FindStringSubmatch(name); m != nil {
+			n, _ := strconv.Atoi(m[1])
+			return n
+		}
+	}
+	return 0
+}
+
+// episodeNumbers returns the season and episode numbers of an item, 0 when
+// unknown. The title is only used for the episode number.
+func episodeNumbers(itemURL, title string) (season, episode int) {
+	if m := episodeKeyPattern.FindStringSubmatch(itemURL); m != nil {
+		season, _ = strconv.Atoi(m[1])
+		episode, _ = strconv.Atoi(m[2])
+		return season, episode
+	}
+	if m := episodeTitlePattern.FindStringSubmatch(title); m != nil {
+		episode, _ = strconv.Atoi(m[1])
+	}
+	return 0, episode
+}
+
+var (
+	// touTvShowKey matches the keys of the shows.
+	touTvShowKey = regexp.MustCompile(`^[a-z0-9][a-z0-9-]*$`)
+	// touTvPages are the first path elements of the pages which aren't
+	// shows.
+	touTvPages = map[string]bool{
+		"categorie": true, "section": true, "recherche": true, "a-propos": true,
+		"aide": true, "connexion": true, "abonnement": true, "profil": true,
+	}
+)
+
+// showPage returns the show a link of a section index points to, the
+// links to episodes count as links to their show.
+func (p *touTvProvider) showPage(section, link *url.URL) (string, bool) {
+	if !p.Match(link) {
+		return "", false
+	}
+	key := strings.Split(strings.Trim(link.Path, "/"), "/")[0]
+	sectionKey := strings.Split(strings.Trim(section.Path, "/"), "/")[0]
+	if !touTvShowKey.MatchString(key) || touTvPages[key] || key == sectionKey {
+		return "", false
+	}
+	return p.itemURL(key), true
+}
+
+// listedItems remembers the listed items by media and by page, a video can
+// be listed with its media in a lineup and without it in another.
+type listedItems map[string]bool
+
+// add records the item, false is returned when it was already listed.
+func (l listedItems) add(item PresentationItem) bool {
+	var keys []string
+	if item.IDMedia != "" {
+		keys = append(keys, "media:"+item.IDMedia)
+	}
+	// the page is either a path or an absolute URL
+	if u, err := url.Parse(item.URL); err == nil && strings.Trim(u.Path, "/") != "" {
+		keys = append(keys, "page:"+strings.ToLower(strings.Trim(u.Path, "/")))
+	}
+	for _, key := range keys {
+		if l[key] {
+			return false
+		}
+	}
+	for _, key := range keys {
+		l[key] = true
+	}
+	return true
+}
+
+// isShowItem reports whether the item URL is a video of the show, as opposed
+// to another show.
+func (p *touTvProvider) isShowItem(showKey, itemURL string) bool {
+	u, err := url.Parse(p.itemURL(itemURL))
+	if err != nil {
+		return false
+	}
+	parts := strings.Split(strings.Trim(u.Path, "/"), "/")
+	return len(parts) > 1 && strings.EqualFold(parts[0], showKey)
+}
+
+// trailerWords identify the trailers in the names and titles, in French and
+// English.
+var trailerWords = []string{"bande-annonce", "bande annonce", "bandes-annonces", "trailer"}
+
+func isTrailer(names ...string) bool {
+	for _, name := range names {
+		name = strings.ToLower(name)
+		for _, word := range trailerWords {
+			if strings.Contains(name, word) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// episode maps a lineup item to an episode.
+func (p *touTvProvider) episode(item PresentationItem) Episode {
+	season, episode := episodeNumbers(item.URL, item.Title)
+	return Episode{
+		Title:         item.Title,
+		URL:           p.itemURL(item.URL),
+		IDMedia:       item.IDMedia,
+		AppCode:       item.AppCode,
+		SeasonNumber:  season,
+		EpisodeNumber: episode,
+		Description:   item.Description,
+		ImageURL:      item.ImageURL,
+		Rating:        item.Details.Rating,
+		Tags:          p.tags(item.Details.Tags),
+		AirDate:       parseAirDate(item.Details.AirDate),
+		Duration:      time.Duration(item.Details.Length) * time.Second,
+		Paid:          !item.IsFree,
+		Unavailable:   !item.IsAvailable,
+	}
+}
+
+// tags flattens the tags of an item, the type of the tag falls back to the
+// key of its group.
+func (p *touTvProvider) tags(groups []PresentationTag) []Tag {
+	var tags []Tag
+	for _, group := range groups {
+		for _, v := range group.Value {
+			if v.Title == "" {
+				continue
+			}
+			tag := Tag{Type: strings.ToLower(v.TypeTag), Title: v.Title}
+			if tag.Type == "" {
+				tag.Type = strings.ToLower(group.Key)
+			}
+			if v.URL != "" {
+				tag.URL = p.itemURL(v.URL)
+			}
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+// Metadata fetches the presentation of the episode.
+func (p *touTvProvider) Metadata(ctx context.Context, ep Episode) (*Episode, error) {
+	u, err := url.Parse(ep.URL)
+	if err != nil {
+		return nil, err
+	}
+	data, err := p.presentation(ctx, strings.Trim(u.Path, "/"))
+	if err != nil {
+		return nil, err
+	}
+	md := p.episode(data.PresentationItem)
+	md.URL = ep.URL
+	return &md, nil
+}
+
+func (p *touTvProvider) ResolveMedia(ctx context.Context, ep Episode) (*MediaStream, error) {
+	id, appCode := ep.IDMedia, ep.AppCode
+	if id == "" {
+		md, err := p.Metadata(ctx, ep)
+		if err != nil {
+			return nil, err
+		}
+		id, appCode = md.IDMedia, md.AppCode
+	}
+	if id == "" {
+		return nil, fmt.Errorf("no media found for %s", ep.URL)
+	}
+	// the items carry the catalogue of their media
+	return rccMediaStream(ctx, id, validationParams{AppCode: appCode})
+}
+
+func (p *touTvProvider) presentation(ctx context.Context, key string) (*PresentationResponse, error) {
+	resp, err := query(ctx, presQuery(key))
+	if err != nil {
+		return nil, fmt.Errorf("something went wrong connecting to the server - %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return nil, fmt.Errorf("the server didn't respond with the expected status code, got: %d - %s", resp.StatusCode, body)
+	}
+	var data PresentationResponse
+	if err = json.NewDecoder(resp.Body).Decode(&data); err != nil {
+		return nil, fmt.Errorf("failed to parse the response data - %v", err)
+	}
+	return &data, nil
+}
+
+// itemURL returns the absolute URL of a lineup item.
+func (p *touTvProvider) itemURL(path string) string {
+	if strings.HasPrefix(path, "http") {
+		return path
+	}
+	return "https://ici.tou.tv/" + strings.TrimPrefix(path, "/")
+}
+
+func query(ctx context.Context, url string) (resp *http.Response, err error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", "Mozilla/5.0 (iPhone; U; CPU iPhone OS 5_0 like Mac OS X; en-us) AppleWebKit/532.9 (KHTML, like Gecko) Version/5.0.5 Mobile/8A293 Safari/6531.22.7")
+	req.Header.Set("Content-Type", "application/json")
+	if err := pacerFrom(ctx).wait(ctx); err != nil {
+		return nil, err
+	}
+	loggerFrom(ctx).Tracef("GET %s", url)
+
+	return http.DefaultClient.Do(req.WithContext(ctx))
+}
+
+func presQuery(showKey string) string {
+	return fmt.Sprintf("%s%s?v=2&d=android&excludeLineups=0", presentationURL, showKey)
+}
+
+// PresentationResponse is the JSON structure returned by the presentation
+// API. The presentation of an episode describes the episode itself, the one
+// of a show lists its episodes in lineups.
+type PresentationResponse struct {
+	PresentationItem
+	ExternalLinks []struct {
+		Title    string `json:"Title"`
+		Text     string `json:"Text"`
+		URL      string `json:"Url"`
+		ImageURL string `json:"ImageUrl"`
+		LogoName string `json:"LogoName"`
+		LogoURL  string `json:"LogoUrl"`
+	} `json:"ExternalLinks"`
+	ITunesLink               interface{}          `json:"ITunesLink"`
+	CreditStartTimeInSeconds float64              `json:"CreditStartTimeInSeconds"`
+	LengthInSeconds          float64              `json:"LengthInSeconds"`
+	OtherLineups             []PresentationLineup `json:"OtherLineups"`
+	SelectedSeasonName       string               `json:"SelectedSeasonName"`
+	SeasonLineups            []PresentationLineup `json:"SeasonLineups"`
+	SeasonLineupsTitle       interface{}          `json:"SeasonLineupsTitle"`
+	HasPlayButton            bool                 `json:"HasPlayButton"`
+	PlayButtonText           string               `json:"PlayButtonText"`
+	PlayButtonText2          string               `json:"PlayButtonText2"`
+	StatsMetas               struct {
+		Description                     string `json:"description"`
+		RcDomaine                       string `json:"rc.domaine"`
+		RcApplication                   string `json:"rc.application"`
+		RcFormatapplication             string `json:"rc.formatapplication"`
+		RcSection                       string `json:"rc.section"`
+		RcGroupesection                 string `json:"rc.groupesection"`
+		RcListe                         string `json:"rc.liste"`
+		RcSegment                       string `json:"rc.segment"`
+		RcPagesegment                   string `json:"rc.pagesegment"`
+		RcCodepage                      string `json:"rc.codepage"`
+		RcNiveau                        string `json:"rc.niveau"`
+		RcEmission                      string `json:"rc.emission"`
+		RcCodeemission                  string `json:"rc.codeemission"`
+		RcTitre                         string `json:"rc.titre"`
+		RcSaison                        string `json:"rc.saison"`
+		RcEpisode                       string `json:"rc.episode"`
+		RcCollection                    string `json:"rc.collection"`
+		RcGenre                         string `json:"rc.genre"`
+		RcVientdemaliste                string `json:"rc.vientdemaliste"`
+		RcAcces                         string `json:"rc.acces"`
+		RcTelco                         string `json:"rc.telco"`
+		RcPlan                          string `json:"rc.plan"`
+		RcForfait                       string `json:"rc.forfait"`
+		RcIdcampagne                    string `json:"rc.idcampagne"`
+		AppleMediaServiceSubscriptionV2 string `json:"apple-media-service-subscription-v2"`
+		Keywords                        string `json:"keywords"`
+		RcExtra                         string `json:"rc.extra"`
+		FbAppID                         string `json:"fb:app_id"`
+		OgTitle                         string `json:"og:title"`
+		OgDescription                   string `json:"og:description"`
+		OgURL                           string `json:"og:url"`
+		OgType                          string `json:"og:type"`
+		OgImage                         string `json:"og:image"`
+	} `json:"StatsMetas"`
+	MediaURL                   string      `json:"MediaUrl"`
+	MediaTitle                 string      `json:"MediaTitle"`
+	BackgroundImageURL         interface{} `json:"BackgroundImageUrl"`
+	IsPubMandatoryForAllUsers  bool        `json:"IsPubMandatoryForAllUsers"`
+	IsPubMandatoryForFreeUsers bool        `json:"IsPubMandatoryForFreeUsers"`
+	ShowPub                    bool        `json:"ShowPub"`
+	// URL isn't a string at this level.
+	URL interface{} `json:"Url"`
+}
+
+// PresentationLineup is a list of items of a presentation, for instance the
+// episodes of a season or the extras.
+type PresentationLineup struct {
+	SelectedIndex           interface{}        `json:"SelectedIndex"`
+	Name                    string             `json:"Name"`
+	Title                   string             `json:"Title"`
+	HasURL                  bool               `json:"HasUrl"`
+	URL                     interface{}        `json:"Url"`
+	Ratio                   string             `json:"Ratio"`
+	Color                   string             `json:"Color"`
+	LineupItems             []PresentationItem `json:"LineupItems"`
+	HasLineupNavigation     bool               `json:"HasLineupNavigation"`
+	IsFree                  bool               `json:"IsFree"`
+	LineupNavigationItems   interface{}        `json:"LineupNavigationItems"`
+	Header                  interface{}        `json:"Header"`
+	FilterValueA            interface{}        `json:"FilterValueA"`
+	FilterValueB            interface{}        `json:"FilterValueB"`
+	LineupItemFiltersA      []interface{}      `json:"LineupItemFiltersA"`
+	ActiveLineupItemFilterA interface{}        `json:"ActiveLineupItemFilterA"`
+	Behaviour               string             `json:"Behaviour"`
+	LineupItemTextTemplate  interface{}        `json:"LineupItemTextTemplate"`
+	Theme                   interface{}        `json:"Theme"`
+}
+
+// PresentationItem is an episode, or another video, of a presentation. The
+// items of the other lineups don't have a media id.
+type PresentationItem struct {
+	IDMedia              string              `json:"IdMedia"`
+	AppCode              string              `json:"AppCode"`
+	CapsuleType          interface{}         `json:"CapsuleType"`
+	IsNew                bool                `json:"IsNew"`
+	NoFMC                interface{}         `json:"NoFMC"`
+	IsAvailable          bool                `json:"IsAvailable"`
+	BookmarkKey          string              `json:"BookmarkKey"`
+	Key                  string              `json:"Key"`
+	AppleKey             string              `json:"AppleKey"`
+	Template             string              `json:"Template"`
+	Title                string              `json:"Title"`
+	IsFree               bool                `json:"IsFree"`
+	IsDrm                bool                `json:"IsDrm"`
+	IsActive             bool                `json:"IsActive"`
+	Description          string              `json:"Description"`
+	PromoDescription     interface{}         `json:"PromoDescription"`
+	ImageURL             string              `json:"ImageUrl"`
+	URL                  string              `json:"Url"`
+	TrackingURL          interface{}         `json:"TrackingUrl"`
+	Details              PresentationDetails `json:"Details"`
+	Details2             interface{}         `json:"Details2"`
+	DepartureDescription interface{}         `json:"DepartureDescription"`
+	MigrationDescription interface{}         `json:"MigrationDescription"`
+	ArrivalDescription   interface{}         `json:"ArrivalDescription"`
+	Share                struct {
+		ShareTitle  string `json:"ShareTitle"`
+		URL         string `json:"Url"`
+		AbsoluteURL string `json:"AbsoluteUrl"`
+	} `json:"Share"`
+	Length           interface{} `json:"Length"`
+	FilterValueA     interface{} `json:"FilterValueA"`
+	IsGeolocalized   bool        `json:"IsGeolocalized"`
+	HasNewEpisodes   bool        `json:"HasNewEpisodes"`
+	ExcludeDevice    interface{} `json:"ExcludeDevice"`
+	LogoTargettingID interface{} `json:"LogoTargettingId"`
+}
+
+// PresentationDetails describes an item.
+type PresentationDetails struct {
+	Rating         string            `json:"Rating"`
+	Networks       interface{}       `json:"Networks"`
+	Country        interface{}       `json:"Country"`
+	AirDate        string            `json:"AirDate"`
+	Copyright      interface{}       `json:"Copyright"`
+	Persons        interface{}       `json:"Persons"`
+	Tags           []PresentationTag `json:"Tags"`
+	Length         int               `json:"Length"`
+	Description    string            `json:"Description"`
+	DetailsTitle   string            `json:"DetailsTitle"`
+	ImageURL       string            `json:"ImageUrl"`
+	ProductionYear int               `json:"ProductionYear"`
+	LengthText     interface{}       `json:"LengthText"`
+	OriginalTitle  interface{}       `json:"OriginalTitle"`
+	Type           string            `json:"Type"`
+}
+
+// PresentationTag groups the tags of an item by kind.
+type PresentationTag struct {
+	Key   string `json:"Key"`
+	Value []struct {
+		ID                   int           `json:"Id"`
+		URL                  string        `json:"Url"`
+		Title                string        `json:"Title"`
+		TypeTag              string        `json:"TypeTag"`
+		UniversalSearchGenre string        `json:"UniversalSearchGenre"`
+		ChildTags            []interface{} `json:"ChildTags"`
+		ParentTag            interface{}   `json:"ParentTag"`
+	} `json:"Value"`
+}
@@ -0,0 +1,97 @@
+package main
+
+import "testing"
+
+func TestSeasonPattern(t *testing.T) {
+	tests := []struct {
+		in    string
+		match string
+	}{
+		{"Saison 2", "2"},
+		{"saison-02", "2"},
+		{"Season_3", "3"},
+		{"S02", "2"},
+		{"s10", "10"},
+		{"single", ""},
+		{"Épisodes", ""},
+		{"Extraits", ""},
+		{"Les saisons", ""},
+	}
+	for _, tt := range tests {
+		m := seasonPattern.FindStringSubmatch(tt.in)
+		if tt.match == "" {
+			if m != nil {
+				t.Errorf("%q: expected no match, got %q", tt.in, m[0])
+			}
+			continue
+		}
+		if m == nil || m[1] != tt.match {
+			t.Errorf("%q: expected the season %s, got %q", tt.in, tt.match, m)
+		}
+	}
+}
+
+func TestSeasonNumber(t *testing.T) {
+	tests := []struct {
+		names []string
+		want  int
+	}{
+		{[]string{"Saison 2"}, 2},
+		{[]string{"S02"}, 2},
+		{[]string{"saison-10"}, 10},
+		{[]string{"single"}, 0},
+		{[]string{"", "Saison 3"}, 3},
+		{[]string{"S01", "Saison 3"}, 1},
+		{[]string{"Extraits", "Bandes-annonces"}, 0},
+		{nil, 0},
+	}
+	for _, tt := range tests {
+		if got := seasonNumber(tt.names...); got != tt.want {
+			t.Errorf("%q: expected %d, got %d", tt.names, tt.want, got)
+		}
+	}
+}
+
+func TestEpisodeNumbers(t *testing.T) {
+	tests := []struct {
+		url, title      string
+		season, episode int
+	}{
+		{"/show/S02E03", "Le retour", 2, 3},
+		{"https://ici.tou.tv/show/s01e12/", "Épisode 4", 1, 12},
+		{"/show/S2E3", "", 2, 3},
+		{"/show/bande-annonce", "Épisode 04", 0, 4},
+		{"/show/episode", "episode 7 : la fin", 0, 7},
+		{"/show/S02E03x", "Le retour", 0, 0},
+		{"/show/extrait", "Extrait", 0, 0},
+	}
+	for _, tt := range tests {
+		season, episode := episodeNumbers(tt.url, tt.title)
+		if season != tt.season || episode != tt.episode {
+			t.Errorf("%s %q: expected %d %d, got %d %d", tt.url, tt.title, tt.season, tt.episode, season, episode)
+		}
+	}
+}
+
+func TestListedItems(t *testing.T) {
+	items := []struct {
+		item PresentationItem
+		want bool
+	}{
+		{PresentationItem{IDMedia: "1", URL: "/show/S01E01"}, true},
+		{PresentationItem{IDMedia: "1", URL: "/show/S01E01"}, false},
+		// the same page with or without its media
+		{PresentationItem{URL: "https://ici.tou.tv/show/S01E01"}, false},
+		{PresentationItem{URL: "/show/S01E02"}, true},
+		{PresentationItem{URL: "show/S01E02/"}, false},
+		{PresentationItem{IDMedia: "2", URL: "/show/s01e02"}, false},
+		{PresentationItem{IDMedia: "3", URL: "/show/S01E03"}, true},
+		{PresentationItem{IDMedia: "3"}, false},
+	}
+	listed := listedItems{}
+	for i, tt := range items {
+		if got := listed.add(tt.item); got != tt.want {
+			t.Errorf("item %d (%q %q): expected %v, got %v", i, tt.item.IDMedia, tt.item.URL, tt.want, got)
+		}
+	}
+}